@@ -3,9 +3,17 @@ package main
 import (
 	"banner-service/internal/app"
 	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(os.Args[2:]); err != nil {
+			log.Fatalf("failed to migrate %v", err)
+		}
+		return
+	}
+
 	if err := app.Start(); err != nil {
 		log.Fatalf("failed to start app %v", err)
 	}
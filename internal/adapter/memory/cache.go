@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+type item struct {
+	banner    model.Banner
+	expiresAt time.Time
+}
+
+type Cache struct {
+	mu    sync.RWMutex
+	items map[model.BannerKey]item
+	ttl   time.Duration
+	done  chan struct{}
+}
+
+func NewCache(cfg config.CacheConfig) *Cache {
+	c := &Cache{
+		items: make(map[model.BannerKey]item),
+		ttl:   cfg.TTL,
+		done:  make(chan struct{}),
+	}
+	go c.cleanup(cfg.CleanupInterval)
+	return c
+}
+
+func (c *Cache) Get(_ context.Context, key model.BannerKey) (model.Banner, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	it, ok := c.items[key]
+	if !ok || time.Now().After(it.expiresAt) {
+		return model.Banner{}, false, nil
+	}
+	return it.banner, true, nil
+}
+
+func (c *Cache) Set(_ context.Context, key model.BannerKey, b model.Banner) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = item{banner: b, expiresAt: b.CacheExpiry(time.Now(), c.ttl)}
+	return nil
+}
+
+func (c *Cache) Delete(_ context.Context, keys ...model.BannerKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.items, key)
+	}
+	return nil
+}
+
+func (c *Cache) Clear(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[model.BannerKey]item)
+	return nil
+}
+
+func (c *Cache) Close() error {
+	close(c.done)
+	return nil
+}
+
+// cleanup периодически удаляет протухшие записи, чтобы кэш не рос бесконечно
+func (c *Cache) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.evictExpired()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Cache) evictExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	evicted := 0
+	for key, it := range c.items {
+		if now.After(it.expiresAt) {
+			delete(c.items, key)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		log.Printf("[DEBUG] cache: evicted %d expired banners\n", evicted)
+	}
+}
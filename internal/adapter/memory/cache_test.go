@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+func TestCacheExpiration(t *testing.T) {
+	c := NewCache(config.CacheConfig{TTL: 50 * time.Millisecond, CleanupInterval: 10 * time.Millisecond})
+	defer c.Close()
+
+	ctx := context.Background()
+	key := model.BannerKey{TagID: 1, FeatureID: 2}
+	assert.NoError(t, c.Set(ctx, key, model.Banner{ID: 3, Content: "content"}))
+
+	b, ok, err := c.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, b.ID)
+
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.items) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, ok, err = c.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
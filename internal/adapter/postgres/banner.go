@@ -5,25 +5,34 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"banner-service/internal/config"
 	"banner-service/internal/model"
+	"banner-service/internal/service"
 )
 
 type Storage struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
 }
 
 func NewStorage(cfg config.PostgresConfig) (*Storage, error) {
-	var (
-		conn *pgx.Conn
-		err  error
-	)
-	dbPath := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database)
+	poolCfg, err := pgxpool.ParseConfig(dsn(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
 
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -32,166 +41,305 @@ func NewStorage(cfg config.PostgresConfig) (*Storage, error) {
 	for {
 		select {
 		case <-ticker.C:
-			conn, err = pgx.Connect(context.Background(), dbPath)
+			pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 			if err != nil {
 				continue
 			}
-			err = conn.Ping(context.Background())
-			if err != nil {
+			if err = pool.Ping(context.Background()); err != nil {
+				pool.Close()
 				continue
 			}
 			log.Println("successful database connection")
 
-			return &Storage{conn: conn}, nil
+			return &Storage{pool: pool}, nil
 		case <-timeout:
 			return nil, fmt.Errorf("timed out waiting for database to become available")
 		}
 	}
 }
 
-// TODO: Заменить на миграции
-func (s *Storage) Init(ctx context.Context) error {
-	createBanner := `
-		CREATE TABLE IF NOT EXISTS banner (
-			banner_id BIGINT PRIMARY KEY,
-			feature_id BIGINT NOT NULL,
-			content JSON, 
-			is_active BOOLEAN NOT NULL,
-			created_at TIMESTAMP NOT NULL,
-			updated_at TIMESTAMP NOT NULL
-		);`
-
-	createTag := `CREATE TABLE IF NOT EXISTS tag (tag_id BIGINT PRIMARY KEY);`
-
-	createBannerTag := `
-		CREATE TABLE IF NOT EXISTS banner_tag (
-		    banner_id BIGINT NOT NULL,
-		    tag_id BIGINT NOT NULL,
-		    FOREIGN KEY(banner_id) REFERENCES banner(banner_id) ON DELETE CASCADE,
-		    FOREIGN KEY(tag_id) REFERENCES tag(tag_id)
-		);`
-
-	if _, err := s.conn.Exec(ctx, createBanner); err != nil {
-		return err
-	}
-	log.Println("banner table created")
-	if _, err := s.conn.Exec(ctx, createTag); err != nil {
-		return err
-	}
-	log.Println("tag table created")
-	if _, err := s.conn.Exec(ctx, createBannerTag); err != nil {
-		return err
-	}
-	log.Println("banner_tag table created")
-	return nil
+func dsn(cfg config.PostgresConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database)
 }
 
-func (s *Storage) CreateBanner(ctx context.Context, b model.Banner) error {
+func (s *Storage) CreateBanner(ctx context.Context, b model.Banner) (int, error) {
 	log.Println("[DEBUG] db: create banner")
 	q := `
-		INSERT INTO banner (banner_id, feature_id, content, is_active, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6);`
-	_, err := s.conn.Exec(ctx, q, b.ID, b.FeatureID, b.Content, b.IsActive, b.CreatedAt, b.UpdatedAt)
+		INSERT INTO banner (
+		    feature_id, content, localized_content, is_active, active_from, active_until, created_at, updated_at
+		) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING banner_id;`
+	var id int
+	err := s.db(ctx).QueryRow(ctx, q, b.FeatureID, b.Content, b.LocalizedContent,
+		b.IsActive, b.ActiveFrom, b.ActiveUntil, b.CreatedAt, b.UpdatedAt).Scan(&id)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
 func (s *Storage) CreateTag(ctx context.Context, id int) error {
 	log.Println("[DEBUG] db: create tag")
 
-	q := `INSERT INTO tag (tag_id) VALUES ($1);`
-	if _, err := s.conn.Exec(ctx, q, id); err != nil {
+	q := `INSERT INTO tag (tag_id) VALUES ($1) ON CONFLICT DO NOTHING;`
+	if _, err := s.db(ctx).Exec(ctx, q, id); err != nil {
 		return err
 	}
 	return nil
 }
 
+// CreateBannerTagLock связывает баннер с тегом. Если пара (feature_id, tag_id) уже занята другим баннером,
+// возвращает service.ErrAlreadyExists с его идентификатором
 func (s *Storage) CreateBannerTagLock(ctx context.Context, bannerID, tagID int) error {
 	log.Println("[DEBUG] db: create banner tags locks")
 
-	q := `INSERT INTO banner_tag (banner_id, tag_id) VALUES ($1, $2);`
-	if _, err := s.conn.Exec(ctx, q, bannerID, tagID); err != nil {
+	q := `
+		INSERT INTO banner_tag (banner_id, feature_id, tag_id)
+		SELECT banner_id, feature_id, $2 FROM banner WHERE banner_id = $1
+		ON CONFLICT (feature_id, tag_id) DO NOTHING;`
+	result, err := s.db(ctx).Exec(ctx, q, bannerID, tagID)
+	if err != nil {
 		return err
 	}
-	return nil
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	q = `
+		SELECT bt.banner_id, bt.feature_id
+		FROM banner_tag bt
+		JOIN banner b USING (feature_id)
+		WHERE b.banner_id = $1 AND bt.tag_id = $2;`
+	var existingID, featureID int
+	if err := s.db(ctx).QueryRow(ctx, q, bannerID, tagID).Scan(&existingID, &featureID); err != nil {
+		return err
+	}
+	if existingID == bannerID {
+		return nil
+	}
+	return &service.ErrAlreadyExists{BannerID: existingID, TagID: tagID, FeatureID: featureID}
+}
+
+func (s *Storage) CreateBannerRevision(ctx context.Context, r model.BannerRevision) (int, error) {
+	log.Println("[DEBUG] db: create banner revision")
+
+	q := `
+		INSERT INTO banner_revision (banner_id, version, feature_id, tag_ids, content, localized_content,
+		    variants, is_active, updated_at, author)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9
+		FROM banner_revision
+		WHERE banner_id = $1
+		RETURNING version;`
+	var version int
+	err := s.db(ctx).QueryRow(ctx, q, r.BannerID, r.FeatureID, r.Tags, r.Content, r.LocalizedContent,
+		r.Variants, r.IsActive, r.UpdatedAt, r.Author).
+		Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
 }
 
 func (s *Storage) GetUserBanner(ctx context.Context, tagID, featureID int) (model.Banner, error) {
 	log.Println("[DEBUG] db: get user banner")
 	q := `
-		SELECT b.banner_id, b.feature_id, b.content, b.is_active, b.created_at, b.updated_at
+		SELECT b.banner_id, b.feature_id, b.content, b.localized_content,
+		    b.is_active, b.active_from, b.active_until, b.created_at, b.updated_at,
+		` + variantsColumn + `
 		FROM banner b 
 		JOIN banner_tag bt USING (banner_id) 
 		JOIN tag t USING (tag_id)
 		WHERE t.tag_id = $1 AND b.feature_id = $2;`
 
-	row := s.conn.QueryRow(ctx, q, tagID, featureID)
+	row := s.db(ctx).QueryRow(ctx, q, tagID, featureID)
 	var b model.Banner
-	if err := row.Scan(&b.ID, &b.FeatureID, &b.Content, &b.IsActive, &b.CreatedAt, &b.UpdatedAt); err != nil {
+	if err := row.Scan(
+		&b.ID, &b.FeatureID, &b.Content, &b.LocalizedContent,
+		&b.IsActive, &b.ActiveFrom, &b.ActiveUntil, &b.CreatedAt, &b.UpdatedAt, &b.Variants,
+	); err != nil {
 		return model.Banner{}, err
 	}
 
 	return b, nil
 }
 
-func (s *Storage) GetBannersByTag(ctx context.Context, tagID int) ([]model.Banner, error) {
-	log.Println("[DEBUG] db: get user banners by tag")
+func (s *Storage) GetBannerByID(ctx context.Context, id int) (model.Banner, error) {
+	log.Println("[DEBUG] db: get banner by id")
+	return s.getBannerByID(ctx, id, "")
+}
+
+// GetBannerByIDForUpdate блокирует строку баннера до конца транзакции, чтобы параллельные
+// частичные изменения не затирали друг друга
+func (s *Storage) GetBannerByIDForUpdate(ctx context.Context, id int) (model.Banner, error) {
+	log.Println("[DEBUG] db: get banner by id for update")
+	return s.getBannerByID(ctx, id, "FOR UPDATE")
+}
+
+func (s *Storage) getBannerByID(ctx context.Context, id int, lock string) (model.Banner, error) {
 	q := `
-		SELECT b.banner_id, b.feature_id, b.content, b.is_active, b.created_at, b.updated_at
-		FROM banner b 
-		JOIN banner_tag bg USING (banner_id) 
-		JOIN tag t USING (tag_id)
-		WHERE t.tag_id = $1;`
+		SELECT b.banner_id, b.feature_id, b.content, b.localized_content,
+		    b.is_active, b.active_from, b.active_until, b.created_at, b.updated_at
+		FROM banner b
+		WHERE b.banner_id = $1
+		` + lock + `;`
 
-	rows, err := s.conn.Query(ctx, q, tagID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	banners := make([]model.Banner, 0)
-	for rows.Next() {
-		var b model.Banner
-		if err := rows.Scan(&b.ID, &b.FeatureID, &b.Content, &b.IsActive, &b.CreatedAt, &b.UpdatedAt); err != nil {
-			return nil, err
-		}
-		banners = append(banners, b)
+	row := s.db(ctx).QueryRow(ctx, q, id)
+	var b model.Banner
+	if err := row.Scan(
+		&b.ID, &b.FeatureID, &b.Content, &b.LocalizedContent,
+		&b.IsActive, &b.ActiveFrom, &b.ActiveUntil, &b.CreatedAt, &b.UpdatedAt,
+	); err != nil {
+		return model.Banner{}, err
 	}
-	return banners, nil
+
+	return b, nil
 }
 
-func (s *Storage) GetBannersByFeature(ctx context.Context, featureID int) ([]model.Banner, error) {
+var sortColumns = map[string]string{
+	model.SortByID:        "b.banner_id",
+	model.SortByCreatedAt: "b.created_at",
+	model.SortByUpdatedAt: "b.updated_at",
+}
+
+// GetFilteredBanners возвращает страницу баннеров вместе со всеми их тегами. Пустые фильтры не применяются,
+// Limit == -1 означает отсутствие лимита. Баннеры упорядочены по (SortBy, banner_id),
+// если передан Cursor, выдача начинается сразу после него
+func (s *Storage) GetFilteredBanners(
+	ctx context.Context,
+	p model.GetFilteredBannersParams,
+) ([]model.BannerWithTags, error) {
 	log.Println("[DEBUG] db: get filtered banners")
 
-	q := `
-		SELECT b.banner_id, b.feature_id, b.content, b.is_active, b.created_at, b.updated_at
-		FROM banner b 
-		WHERE b.feature_id = $1`
+	sortColumn, ok := sortColumns[p.SortBy]
+	if !ok {
+		sortColumn = sortColumns[model.SortByUpdatedAt]
+	}
+	direction, comparison := "ASC", ">"
+	if p.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
 
-	rows, err := s.conn.Query(ctx, q, featureID)
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := bannerFilterConditions(p, arg)
+	if p.Cursor != nil {
+		if sortColumn == sortColumns[model.SortByID] {
+			conditions = append(conditions, fmt.Sprintf("b.banner_id %s %s::BIGINT", comparison, arg(p.Cursor.ID)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s, b.banner_id) %s (%s::TIMESTAMP, %s::BIGINT)",
+				sortColumn, comparison, arg(p.Cursor.Value), arg(p.Cursor.ID)))
+		}
+	}
+
+	orderBy := fmt.Sprintf("b.banner_id %s", direction)
+	if sortColumn != sortColumns[model.SortByID] {
+		orderBy = fmt.Sprintf("%s %s, %s", sortColumn, direction, orderBy)
+	}
+	var limit *int
+	if p.Limit != -1 {
+		limit = &p.Limit
+	}
+
+	q := fmt.Sprintf(`
+		SELECT b.banner_id, b.feature_id, b.content, b.localized_content,
+		    b.is_active, b.active_from, b.active_until, b.created_at, b.updated_at,
+		    COALESCE((
+		        SELECT array_agg(bt.tag_id ORDER BY bt.tag_id)
+		        FROM banner_tag bt
+		        WHERE bt.banner_id = b.banner_id
+		    ), '{}'),
+		%s
+		FROM banner b
+		%s
+		ORDER BY %s
+		LIMIT %s OFFSET %s;`, variantsColumn, whereClause(conditions), orderBy, arg(limit), arg(p.Offset))
+
+	rows, err := s.db(ctx).Query(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	banners := make([]model.Banner, 0)
+	banners := make([]model.BannerWithTags, 0)
 	for rows.Next() {
-		var b model.Banner
-		if err := rows.Scan(&b.ID, &b.FeatureID, &b.Content, &b.IsActive, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		var b model.BannerWithTags
+		err := rows.Scan(
+			&b.ID, &b.FeatureID, &b.Content, &b.LocalizedContent,
+			&b.IsActive, &b.ActiveFrom, &b.ActiveUntil, &b.CreatedAt, &b.UpdatedAt, &b.Tags, &b.Variants,
+		)
+		if err != nil {
 			return nil, err
 		}
 		banners = append(banners, b)
 	}
+	return banners, rows.Err()
+}
+
+// CountBanners возвращает число баннеров, подходящих под фильтры p, без учета пагинации
+func (s *Storage) CountBanners(ctx context.Context, p model.GetFilteredBannersParams) (int, error) {
+	log.Println("[DEBUG] db: count banners")
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	q := fmt.Sprintf(`SELECT count(*) FROM banner b %s;`, whereClause(bannerFilterConditions(p, arg)))
 
-	return banners, nil
+	var total int
+	if err := s.db(ctx).QueryRow(ctx, q, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// bannerFilterConditions собирает условия WHERE для фильтров списка баннеров.
+// arg добавляет значение в список аргументов запроса и возвращает его плейсхолдер
+func bannerFilterConditions(p model.GetFilteredBannersParams, arg func(any) string) []string {
+	var conditions []string
+	if len(p.TagIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (
+		    SELECT 1 FROM banner_tag bt WHERE bt.banner_id = b.banner_id AND bt.tag_id = ANY(%s::BIGINT[]))`,
+			arg(p.TagIDs)))
+	}
+	if len(p.FeatureIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("b.feature_id = ANY(%s::BIGINT[])", arg(p.FeatureIDs)))
+	}
+	if p.IsActive != nil {
+		conditions = append(conditions, fmt.Sprintf("b.is_active = %s", arg(*p.IsActive)))
+	}
+	if p.CreatedFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("b.created_at >= %s::TIMESTAMP", arg(*p.CreatedFrom)))
+	}
+	if p.CreatedTo != nil {
+		conditions = append(conditions, fmt.Sprintf("b.created_at <= %s::TIMESTAMP", arg(*p.CreatedTo)))
+	}
+	if p.UpdatedFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("b.updated_at >= %s::TIMESTAMP", arg(*p.UpdatedFrom)))
+	}
+	if p.UpdatedTo != nil {
+		conditions = append(conditions, fmt.Sprintf("b.updated_at <= %s::TIMESTAMP", arg(*p.UpdatedTo)))
+	}
+	return conditions
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, "\n\t\t    AND ")
 }
 
 func (s *Storage) GetTagsByBannerID(ctx context.Context, bannerID int) ([]int, error) {
 	log.Println("[DEBUG] db: get tags by id")
 
 	q := `SELECT tag_id FROM tag t JOIN banner_tag bt USING (tag_id) WHERE bt.banner_id = $1`
-	rows, err := s.conn.Query(ctx, q, bannerID)
+	rows, err := s.db(ctx).Query(ctx, q, bannerID)
 	if err != nil {
 		return nil, err
 	}
@@ -207,30 +355,56 @@ func (s *Storage) GetTagsByBannerID(ctx context.Context, bannerID int) ([]int, e
 	return tags, nil
 }
 
-func (s *Storage) GetAllBanners(ctx context.Context) ([]model.Banner, error) {
-	log.Println("[DEBUG] db: get all banners")
+func (s *Storage) GetBannerRevisions(ctx context.Context, bannerID int) ([]model.BannerRevision, error) {
+	log.Println("[DEBUG] db: get banner revisions")
 
-	rows, err := s.conn.Query(ctx, `SELECT * FROM banner;`)
+	q := `
+		SELECT banner_id, version, feature_id, tag_ids, content, localized_content,
+		    variants, is_active, updated_at, author
+		FROM banner_revision
+		WHERE banner_id = $1
+		ORDER BY version;`
+	rows, err := s.db(ctx).Query(ctx, q, bannerID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	banners := make([]model.Banner, 0)
+	revisions := make([]model.BannerRevision, 0)
 	for rows.Next() {
-		var b model.Banner
-		if err := rows.Scan(&b.ID, &b.FeatureID, &b.Content, &b.IsActive, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		var r model.BannerRevision
+		err := rows.Scan(&r.BannerID, &r.Version, &r.FeatureID, &r.Tags, &r.Content, &r.LocalizedContent,
+			&r.Variants, &r.IsActive, &r.UpdatedAt, &r.Author)
+		if err != nil {
 			return nil, err
 		}
-		banners = append(banners, b)
+		revisions = append(revisions, r)
 	}
-	return banners, nil
+	return revisions, nil
+}
+
+func (s *Storage) GetBannerRevision(ctx context.Context, bannerID, version int) (model.BannerRevision, error) {
+	log.Println("[DEBUG] db: get banner revision")
+
+	q := `
+		SELECT banner_id, version, feature_id, tag_ids, content, localized_content,
+		    variants, is_active, updated_at, author
+		FROM banner_revision
+		WHERE banner_id = $1 AND version = $2;`
+	var r model.BannerRevision
+	err := s.db(ctx).QueryRow(ctx, q, bannerID, version).
+		Scan(&r.BannerID, &r.Version, &r.FeatureID, &r.Tags, &r.Content, &r.LocalizedContent,
+			&r.Variants, &r.IsActive, &r.UpdatedAt, &r.Author)
+	if err != nil {
+		return model.BannerRevision{}, err
+	}
+	return r, nil
 }
 
 func (s *Storage) GetAllTags(ctx context.Context) ([]int, error) {
 	log.Println("[DEBUG] db: get all tags")
 
-	rows, err := s.conn.Query(ctx, `SELECT tag_id FROM tag;`)
+	rows, err := s.db(ctx).Query(ctx, `SELECT tag_id FROM tag;`)
 	if err != nil {
 		return nil, err
 	}
@@ -253,10 +427,14 @@ func (s *Storage) PatchBanner(ctx context.Context, b model.Banner) error {
 		UPDATE banner
 		SET feature_id = $1,
 			content = $2,
-			is_active = $3,
-			updated_at = $4
-		WHERE banner_id = $5;`
-	result, err := s.conn.Exec(ctx, q, b.FeatureID, b.Content, b.IsActive, b.UpdatedAt, b.ID)
+			localized_content = $3,
+			is_active = $4,
+			active_from = $5,
+			active_until = $6,
+			updated_at = $7
+		WHERE banner_id = $8;`
+	result, err := s.db(ctx).Exec(ctx, q, b.FeatureID, b.Content, b.LocalizedContent,
+		b.IsActive, b.ActiveFrom, b.ActiveUntil, b.UpdatedAt, b.ID)
 	if err != nil {
 		return err
 	}
@@ -269,7 +447,7 @@ func (s *Storage) PatchBanner(ctx context.Context, b model.Banner) error {
 func (s *Storage) DeleteBanner(ctx context.Context, id int) error {
 	log.Println("[DEBUG] db: delete banner")
 
-	result, err := s.conn.Exec(ctx, `DELETE FROM banner WHERE banner_id = $1;`, id)
+	result, err := s.db(ctx).Exec(ctx, `DELETE FROM banner WHERE banner_id = $1;`, id)
 	if err != nil {
 		return err
 	}
@@ -282,15 +460,16 @@ func (s *Storage) DeleteBanner(ctx context.Context, id int) error {
 func (s *Storage) DeleteBannerTagsLocks(ctx context.Context, id int) error {
 	log.Println("[DEBUG] db: delete banner tags locks")
 
-	_, err := s.conn.Exec(ctx, `DELETE FROM banner_tag WHERE banner_id = $1;`, id)
+	_, err := s.db(ctx).Exec(ctx, `DELETE FROM banner_tag WHERE banner_id = $1;`, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Storage) Close(ctx context.Context) error {
-	log.Println("[DEBUG] db: close connection")
+func (s *Storage) Close(context.Context) error {
+	log.Println("[DEBUG] db: close connection pool")
 
-	return s.conn.Close(ctx)
+	s.pool.Close()
+	return nil
 }
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+const (
+	bannerChangesChannel = "banner_changes"
+	// payload в NOTIFY ограничен 8000 байт, поэтому ключи отправляются пачками
+	notifyBatchSize   = 100
+	reconnectInterval = time.Second
+)
+
+func (s *Storage) NotifyBannersChanged(ctx context.Context, keys []model.BannerKey) error {
+	log.Println("[DEBUG] db: notify banners changed")
+
+	for start := 0; start < len(keys); start += notifyBatchSize {
+		end := min(start+notifyBatchSize, len(keys))
+		payload, err := json.Marshal(keys[start:end])
+		if err != nil {
+			return err
+		}
+		if _, err := s.db(ctx).Exec(ctx, `SELECT pg_notify($1, $2);`, bannerChangesChannel, string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Listener держит отдельное от Storage соединение, на котором слушает изменения баннеров
+type Listener struct {
+	connect           func(context.Context) (listenConn, error)
+	reconnectInterval time.Duration
+}
+
+// listenConn - часть *pgx.Conn, нужная Listener
+type listenConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+func NewListener(cfg config.PostgresConfig) *Listener {
+	dbPath := dsn(cfg)
+	return &Listener{
+		connect: func(ctx context.Context) (listenConn, error) {
+			return pgx.Connect(ctx, dbPath)
+		},
+		reconnectInterval: reconnectInterval,
+	}
+}
+
+// Listen блокируется до отмены ctx, передавая в handle ключи измененных баннеров.
+// При обрыве соединения переподключается. Уведомления, отправленные, пока соединения не было,
+// теряются, поэтому после каждой успешной подписки вызывается resync
+func (l *Listener) Listen(
+	ctx context.Context,
+	handle func(context.Context, []model.BannerKey),
+	resync func(context.Context) error,
+) {
+	for {
+		if err := l.listen(ctx, handle, resync); err != nil && ctx.Err() == nil {
+			log.Printf("banner changes listener failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.reconnectInterval):
+		}
+	}
+}
+
+func (l *Listener) listen(
+	ctx context.Context,
+	handle func(context.Context, []model.BannerKey),
+	resync func(context.Context) error,
+) error {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close(context.Background())
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+bannerChangesChannel); err != nil {
+		return err
+	}
+	log.Printf("listening on %s channel\n", bannerChangesChannel)
+	if err := resync(ctx); err != nil {
+		log.Printf("failed to resync after subscribing to banner changes: %v\n", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var keys []model.BannerKey
+		if err := json.Unmarshal([]byte(notification.Payload), &keys); err != nil {
+			log.Printf("malformed banner changes payload: %v\n", err)
+			continue
+		}
+		handle(ctx, keys)
+	}
+}
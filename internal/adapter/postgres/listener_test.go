@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"banner-service/internal/model"
+)
+
+// fakeConn отдает заранее заданные payload, после чего соединение обрывается
+type fakeConn struct {
+	payloads []string
+	listened []string
+}
+
+func (c *fakeConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.listened = append(c.listened, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakeConn) WaitForNotification(context.Context) (*pgconn.Notification, error) {
+	if len(c.payloads) == 0 {
+		return nil, errors.New("connection lost")
+	}
+	payload := c.payloads[0]
+	c.payloads = c.payloads[1:]
+	return &pgconn.Notification{Channel: bannerChangesChannel, Payload: payload}, nil
+}
+
+func (c *fakeConn) Close(context.Context) error {
+	return nil
+}
+
+func TestListenerResyncsAfterReconnect(t *testing.T) {
+	conns := []*fakeConn{
+		{payloads: []string{`[{"tag_id":1,"feature_id":2}]`, `not json`}},
+		{payloads: []string{`[{"tag_id":3,"feature_id":4},{"tag_id":5,"feature_id":4}]`}},
+	}
+
+	var (
+		mu      sync.Mutex
+		events  []string
+		handled []model.BannerKey
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	connected := 0
+	l := &Listener{
+		connect: func(context.Context) (listenConn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if connected == len(conns) {
+				cancel()
+				return nil, context.Canceled
+			}
+			connected++
+			return conns[connected-1], nil
+		},
+		reconnectInterval: time.Millisecond,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.Listen(ctx,
+			func(_ context.Context, keys []model.BannerKey) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, "handle")
+				handled = append(handled, keys...)
+			},
+			func(context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, "resync")
+				return nil
+			},
+		)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("listener did not stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// после каждой подписки кэш пересинхронизируется, некорректный payload пропускается
+	assert.Equal(t, []string{"resync", "handle", "resync", "handle"}, events)
+	assert.Equal(t, []model.BannerKey{
+		{TagID: 1, FeatureID: 2},
+		{TagID: 3, FeatureID: 4},
+		{TagID: 5, FeatureID: 4},
+	}, handled)
+	for _, conn := range conns {
+		require.Len(t, conn.listened, 1)
+		assert.Equal(t, "LISTEN "+bannerChangesChannel, conn.listened[0])
+	}
+}
@@ -0,0 +1,227 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationsLockID — ключ advisory lock, чтобы несколько реплик не накатывали миграции одновременно
+const migrationsLockID = 4201
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// MigrateUp накатывает все еще не примененные миграции, каждую в своей транзакции
+func (s *Storage) MigrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := s.createSchemaVersion(ctx); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		err := s.WithTx(ctx, func(ctx context.Context) error {
+			applied, err := s.lockAndGetApplied(ctx)
+			if err != nil {
+				return err
+			}
+			if _, ok := applied[m.version]; ok {
+				return nil
+			}
+			if _, err := s.db(ctx).Exec(ctx, m.up); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+			}
+			q := `INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, $3);`
+			if _, err := s.db(ctx).Exec(ctx, q, m.version, m.name, time.Now()); err != nil {
+				return err
+			}
+			log.Printf("applied migration %04d_%s\n", m.version, m.name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown откатывает последнюю примененную миграцию
+func (s *Storage) MigrateDown(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := s.createSchemaVersion(ctx); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(ctx context.Context) error {
+		applied, err := s.lockAndGetApplied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if _, err := s.db(ctx).Exec(ctx, m.down); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+			}
+			if _, err := s.db(ctx).Exec(ctx, `DELETE FROM schema_version WHERE version = $1;`, m.version); err != nil {
+				return err
+			}
+			log.Printf("reverted migration %04d_%s\n", m.version, m.name)
+			return nil
+		}
+		log.Println("no migrations to revert")
+		return nil
+	})
+}
+
+func (s *Storage) MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createSchemaVersion(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := s.getApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if appliedAt, ok := applied[m.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *Storage) createSchemaVersion(ctx context.Context) error {
+	q := `
+		CREATE TABLE IF NOT EXISTS schema_version (
+		    version INT PRIMARY KEY,
+		    name TEXT NOT NULL,
+		    applied_at TIMESTAMP NOT NULL
+		);`
+	_, err := s.db(ctx).Exec(ctx, q)
+	return err
+}
+
+func (s *Storage) lockAndGetApplied(ctx context.Context) (map[int]time.Time, error) {
+	if _, err := s.db(ctx).Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, migrationsLockID); err != nil {
+		return nil, err
+	}
+	return s.getApplied(ctx)
+}
+
+func (s *Storage) getApplied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.db(ctx).Query(ctx, `SELECT version, applied_at FROM schema_version;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// loadMigrations читает пары файлов вида 0001_name.up.sql и 0001_name.down.sql
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		base := strings.TrimSuffix(strings.TrimPrefix(file, "migrations/"), ".sql")
+		name, direction, ok := cutLast(base, ".")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name: %s", file)
+		}
+		rawVersion, name, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name: %s", file)
+		}
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration version in %s: %w", file, err)
+		}
+
+		data, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		switch direction {
+		case "up":
+			m.up = string(data)
+		case "down":
+			m.down = string(data)
+		default:
+			return nil, fmt.Errorf("unknown migration direction in %s", file)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS banner (
+    banner_id BIGINT PRIMARY KEY,
+    feature_id BIGINT NOT NULL,
+    content JSON,
+    is_active BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tag (tag_id BIGINT PRIMARY KEY);
+
+CREATE TABLE IF NOT EXISTS banner_tag (
+    banner_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    FOREIGN KEY(banner_id) REFERENCES banner(banner_id) ON DELETE CASCADE,
+    FOREIGN KEY(tag_id) REFERENCES tag(tag_id)
+);
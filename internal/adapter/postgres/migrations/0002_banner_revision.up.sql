@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS banner_revision (
+    banner_id BIGINT NOT NULL,
+    version INT NOT NULL,
+    feature_id BIGINT NOT NULL,
+    tag_ids BIGINT[] NOT NULL,
+    content JSON,
+    is_active BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    author TEXT NOT NULL,
+    PRIMARY KEY (banner_id, version),
+    FOREIGN KEY(banner_id) REFERENCES banner(banner_id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE banner_tag DROP CONSTRAINT IF EXISTS banner_tag_banner_id_feature_id_fkey;
+ALTER TABLE banner_tag DROP CONSTRAINT IF EXISTS banner_tag_feature_id_tag_id_key;
+ALTER TABLE banner DROP CONSTRAINT IF EXISTS banner_banner_id_feature_id_key;
+ALTER TABLE banner_tag DROP COLUMN IF EXISTS feature_id;
@@ -0,0 +1,52 @@
+-- feature_id дублируется в banner_tag, чтобы уникальность пары (feature_id, tag_id)
+-- обеспечивалась индексом, а не проверкой перед вставкой
+ALTER TABLE banner_tag ADD COLUMN IF NOT EXISTS feature_id BIGINT;
+
+UPDATE banner_tag bt SET feature_id = b.feature_id
+FROM banner b
+WHERE b.banner_id = bt.banner_id AND bt.feature_id IS NULL;
+
+ALTER TABLE banner_tag ALTER COLUMN feature_id SET NOT NULL;
+
+-- повторные связи одного баннера с тегом ничего не меняют, их можно удалить
+DELETE FROM banner_tag a
+USING banner_tag b
+WHERE a.banner_id = b.banner_id AND a.tag_id = b.tag_id AND a.ctid > b.ctid;
+
+-- до этой миграции уникальность проверялась с гонкой при создании и не проверялась при изменении,
+-- поэтому пара может принадлежать нескольким баннерам. Какой из них оставить, решает администратор:
+-- миграция останавливается со списком таких пар
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('feature_id=%s tag_id=%s banner_ids=%s', feature_id, tag_id, banner_ids), E'\n'
+        ORDER BY feature_id, tag_id)
+    INTO conflicts
+    FROM (
+        SELECT feature_id, tag_id, array_agg(banner_id ORDER BY banner_id) AS banner_ids
+        FROM banner_tag
+        GROUP BY feature_id, tag_id
+        HAVING count(*) > 1
+    ) duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'banner_tag has (feature_id, tag_id) pairs used by several banners, '
+            'remove extra banners or their tags and rerun the migration:%', E'\n' || conflicts;
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'banner_banner_id_feature_id_key') THEN
+        ALTER TABLE banner ADD CONSTRAINT banner_banner_id_feature_id_key UNIQUE (banner_id, feature_id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'banner_tag_feature_id_tag_id_key') THEN
+        ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_feature_id_tag_id_key UNIQUE (feature_id, tag_id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'banner_tag_banner_id_feature_id_fkey') THEN
+        ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_banner_id_feature_id_fkey
+            FOREIGN KEY (banner_id, feature_id) REFERENCES banner (banner_id, feature_id)
+            ON UPDATE CASCADE ON DELETE CASCADE;
+    END IF;
+END $$;
@@ -0,0 +1,23 @@
+ALTER TABLE banner ALTER COLUMN banner_id DROP IDENTITY IF EXISTS;
+
+ALTER TABLE banner_tag DROP CONSTRAINT banner_tag_banner_id_fkey;
+ALTER TABLE banner_tag DROP CONSTRAINT banner_tag_banner_id_feature_id_fkey;
+ALTER TABLE banner_revision DROP CONSTRAINT banner_revision_banner_id_fkey;
+
+-- баннеры, созданные после миграции, сохраняют свои идентификаторы
+UPDATE banner b SET banner_id = -m.old_id FROM banner_id_map m WHERE b.banner_id = m.new_id;
+UPDATE banner SET banner_id = -banner_id WHERE banner_id < 0;
+UPDATE banner_tag bt SET banner_id = -m.old_id FROM banner_id_map m WHERE bt.banner_id = m.new_id;
+UPDATE banner_tag SET banner_id = -banner_id WHERE banner_id < 0;
+UPDATE banner_revision r SET banner_id = -m.old_id FROM banner_id_map m WHERE r.banner_id = m.new_id;
+UPDATE banner_revision SET banner_id = -banner_id WHERE banner_id < 0;
+
+ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_banner_id_fkey
+    FOREIGN KEY (banner_id) REFERENCES banner (banner_id) ON DELETE CASCADE;
+ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_banner_id_feature_id_fkey
+    FOREIGN KEY (banner_id, feature_id) REFERENCES banner (banner_id, feature_id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE banner_revision ADD CONSTRAINT banner_revision_banner_id_fkey
+    FOREIGN KEY (banner_id) REFERENCES banner (banner_id) ON DELETE CASCADE;
+
+DROP TABLE banner_id_map;
@@ -0,0 +1,35 @@
+-- Раньше идентификаторы генерировались через rand.Int() и не помещались в Number в JavaScript.
+-- Существующие баннеры перенумеровываются по порядку создания, а соответствие старых и новых
+-- идентификаторов сохраняется в banner_id_map, чтобы клиенты могли найти баннер по старому id
+CREATE TABLE banner_id_map (
+    old_id BIGINT PRIMARY KEY,
+    new_id BIGINT NOT NULL UNIQUE
+);
+
+INSERT INTO banner_id_map (old_id, new_id)
+SELECT banner_id, row_number() OVER (ORDER BY created_at, banner_id)
+FROM banner;
+
+ALTER TABLE banner_tag DROP CONSTRAINT banner_tag_banner_id_fkey;
+ALTER TABLE banner_tag DROP CONSTRAINT banner_tag_banner_id_feature_id_fkey;
+ALTER TABLE banner_revision DROP CONSTRAINT banner_revision_banner_id_fkey;
+
+-- промежуточные отрицательные значения исключают пересечение новых id со старыми
+UPDATE banner b SET banner_id = -m.new_id FROM banner_id_map m WHERE b.banner_id = m.old_id;
+UPDATE banner SET banner_id = -banner_id WHERE banner_id < 0;
+UPDATE banner_tag bt SET banner_id = -m.new_id FROM banner_id_map m WHERE bt.banner_id = m.old_id;
+UPDATE banner_tag SET banner_id = -banner_id WHERE banner_id < 0;
+UPDATE banner_revision r SET banner_id = -m.new_id FROM banner_id_map m WHERE r.banner_id = m.old_id;
+UPDATE banner_revision SET banner_id = -banner_id WHERE banner_id < 0;
+
+ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_banner_id_fkey
+    FOREIGN KEY (banner_id) REFERENCES banner (banner_id) ON DELETE CASCADE;
+ALTER TABLE banner_tag ADD CONSTRAINT banner_tag_banner_id_feature_id_fkey
+    FOREIGN KEY (banner_id, feature_id) REFERENCES banner (banner_id, feature_id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER TABLE banner_revision ADD CONSTRAINT banner_revision_banner_id_fkey
+    FOREIGN KEY (banner_id) REFERENCES banner (banner_id) ON DELETE CASCADE;
+
+ALTER TABLE banner ALTER COLUMN banner_id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('banner', 'banner_id'), COALESCE(MAX(banner_id), 0) + 1, false)
+FROM banner;
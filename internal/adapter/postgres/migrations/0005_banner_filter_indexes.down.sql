@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS banner_tag_banner_id_idx;
+DROP INDEX IF EXISTS banner_feature_id_idx;
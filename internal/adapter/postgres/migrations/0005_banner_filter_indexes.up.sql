@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS banner_feature_id_idx ON banner (feature_id);
+CREATE INDEX IF NOT EXISTS banner_tag_banner_id_idx ON banner_tag (banner_id);
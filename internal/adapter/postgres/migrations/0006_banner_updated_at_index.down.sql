@@ -0,0 +1 @@
+DROP INDEX IF EXISTS banner_updated_at_banner_id_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS banner_updated_at_banner_id_idx ON banner (updated_at, banner_id);
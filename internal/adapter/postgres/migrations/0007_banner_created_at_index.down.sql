@@ -0,0 +1 @@
+DROP INDEX IF EXISTS banner_created_at_banner_id_idx;
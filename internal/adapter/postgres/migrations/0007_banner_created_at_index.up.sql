@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS banner_created_at_banner_id_idx ON banner (created_at, banner_id);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS feature_schema (
+    feature_id BIGINT PRIMARY KEY,
+    schema JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE banner
+    DROP COLUMN IF EXISTS active_until,
+    DROP COLUMN IF EXISTS active_from;
@@ -0,0 +1,3 @@
+ALTER TABLE banner
+    ADD COLUMN IF NOT EXISTS active_from TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS active_until TIMESTAMP;
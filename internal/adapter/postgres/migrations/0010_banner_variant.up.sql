@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS banner_variant (
+    variant_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    banner_id BIGINT NOT NULL,
+    content JSON,
+    weight INT NOT NULL CHECK (weight > 0),
+    FOREIGN KEY(banner_id) REFERENCES banner(banner_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS banner_variant_banner_id_idx ON banner_variant (banner_id);
@@ -0,0 +1,11 @@
+-- variant_id = 0 у баннеров без вариантов, NULL не подходит для первичного ключа
+CREATE TABLE IF NOT EXISTS banner_stats (
+    banner_id BIGINT NOT NULL,
+    day DATE NOT NULL,
+    tag_id BIGINT NOT NULL,
+    variant_id BIGINT NOT NULL DEFAULT 0,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (banner_id, day, tag_id, variant_id),
+    FOREIGN KEY(banner_id) REFERENCES banner(banner_id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE banner DROP COLUMN IF EXISTS localized_content;
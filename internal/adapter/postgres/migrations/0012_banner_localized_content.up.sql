@@ -0,0 +1,2 @@
+-- содержимое по локалям: {"en": {...}, "ru-RU": {...}}. content остается содержимым по умолчанию
+ALTER TABLE banner ADD COLUMN IF NOT EXISTS localized_content JSONB;
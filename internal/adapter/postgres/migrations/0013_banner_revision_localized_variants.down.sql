@@ -0,0 +1,2 @@
+ALTER TABLE banner_revision DROP COLUMN IF EXISTS variants;
+ALTER TABLE banner_revision DROP COLUMN IF EXISTS localized_content;
@@ -0,0 +1,4 @@
+-- версии, записанные до этой миграции, не знают локалей и вариантов: NULL означает, что при откате
+-- они остаются как есть. Новые версии всегда пишут значение, пустое - это '{}' и '[]'
+ALTER TABLE banner_revision ADD COLUMN IF NOT EXISTS localized_content JSONB;
+ALTER TABLE banner_revision ADD COLUMN IF NOT EXISTS variants JSONB;
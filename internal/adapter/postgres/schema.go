@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"banner-service/internal/model"
+)
+
+func (s *Storage) GetFeatureSchema(ctx context.Context, featureID int) (model.FeatureSchema, error) {
+	log.Println("[DEBUG] db: get feature schema")
+
+	q := `SELECT feature_id, schema, updated_at FROM feature_schema WHERE feature_id = $1;`
+	var fs model.FeatureSchema
+	err := s.db(ctx).QueryRow(ctx, q, featureID).Scan(&fs.FeatureID, &fs.Schema, &fs.UpdatedAt)
+	if err != nil {
+		return model.FeatureSchema{}, err
+	}
+	return fs, nil
+}
+
+func (s *Storage) SetFeatureSchema(ctx context.Context, fs model.FeatureSchema) error {
+	log.Println("[DEBUG] db: set feature schema")
+
+	q := `
+		INSERT INTO feature_schema (feature_id, schema, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (feature_id) DO UPDATE SET schema = EXCLUDED.schema, updated_at = EXCLUDED.updated_at;`
+	if _, err := s.db(ctx).Exec(ctx, q, fs.FeatureID, fs.Schema, fs.UpdatedAt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) DeleteFeatureSchema(ctx context.Context, featureID int) error {
+	log.Println("[DEBUG] db: delete feature schema")
+
+	result, err := s.db(ctx).Exec(ctx, `DELETE FROM feature_schema WHERE feature_id = $1;`, featureID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
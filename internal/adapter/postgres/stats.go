@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"banner-service/internal/model"
+)
+
+// AddBannerStats прибавляет счетчики к дневной статистике. Строки удаленных баннеров пропускаются,
+// чтобы один такой баннер не ронял всю пачку на внешнем ключе
+func (s *Storage) AddBannerStats(ctx context.Context, stats []model.BannerStats) error {
+	log.Println("[DEBUG] db: add banner stats")
+
+	n := len(stats)
+	bannerIDs, days, tagIDs := make([]int, 0, n), make([]time.Time, 0, n), make([]int, 0, n)
+	variantIDs, impressions, clicks := make([]int, 0, n), make([]int, 0, n), make([]int, 0, n)
+	for _, st := range stats {
+		bannerIDs = append(bannerIDs, st.BannerID)
+		days = append(days, st.Day)
+		tagIDs = append(tagIDs, st.TagID)
+		variantIDs = append(variantIDs, st.VariantID)
+		impressions = append(impressions, st.Impressions)
+		clicks = append(clicks, st.Clicks)
+	}
+
+	q := `
+		INSERT INTO banner_stats (banner_id, day, tag_id, variant_id, impressions, clicks)
+		SELECT s.banner_id, s.day, s.tag_id, s.variant_id, s.impressions, s.clicks
+		FROM unnest($1::BIGINT[], $2::DATE[], $3::BIGINT[], $4::BIGINT[], $5::BIGINT[], $6::BIGINT[])
+		    AS s (banner_id, day, tag_id, variant_id, impressions, clicks)
+		JOIN banner b ON b.banner_id = s.banner_id
+		ON CONFLICT (banner_id, day, tag_id, variant_id) DO UPDATE
+		SET impressions = banner_stats.impressions + EXCLUDED.impressions,
+		    clicks = banner_stats.clicks + EXCLUDED.clicks;`
+	_, err := s.db(ctx).Exec(ctx, q, bannerIDs, days, tagIDs, variantIDs, impressions, clicks)
+	return err
+}
+
+func (s *Storage) GetBannerStats(ctx context.Context, bannerID int) ([]model.BannerStats, error) {
+	log.Println("[DEBUG] db: get banner stats")
+
+	q := `
+		SELECT banner_id, day, tag_id, variant_id, impressions, clicks
+		FROM banner_stats
+		WHERE banner_id = $1
+		ORDER BY day, tag_id, variant_id;`
+	rows, err := s.db(ctx).Query(ctx, q, bannerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]model.BannerStats, 0)
+	for rows.Next() {
+		var st model.BannerStats
+		if err := rows.Scan(&st.BannerID, &st.Day, &st.TagID, &st.VariantID, &st.Impressions, &st.Clicks); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"banner-service/internal/model"
+)
+
+// variantsColumn собирает варианты баннера b в JSON-массив, чтобы они читались тем же запросом, что и баннер
+const variantsColumn = `
+		COALESCE((
+		    SELECT json_agg(json_build_object(
+		        'variant_id', v.variant_id, 'content', v.content, 'weight', v.weight
+		    ) ORDER BY v.variant_id)
+		    FROM banner_variant v
+		    WHERE v.banner_id = b.banner_id
+		), '[]')`
+
+// CreateBannerVariant создает вариант. Если v.ID задан, вариант восстанавливается с прежним идентификатором,
+// иначе идентификатор выдает база
+func (s *Storage) CreateBannerVariant(ctx context.Context, bannerID int, v model.BannerVariant) (int, error) {
+	log.Println("[DEBUG] db: create banner variant")
+
+	q := `
+		INSERT INTO banner_variant (banner_id, content, weight)
+		VALUES ($1, $2, $3)
+		RETURNING variant_id;`
+	args := []any{bannerID, v.Content, v.Weight}
+	if v.ID != 0 {
+		q = `
+			INSERT INTO banner_variant (banner_id, content, weight, variant_id)
+			VALUES ($1, $2, $3, $4)
+			RETURNING variant_id;`
+		args = append(args, v.ID)
+	}
+	var id int
+	if err := s.db(ctx).QueryRow(ctx, q, args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) UpdateBannerVariant(ctx context.Context, bannerID int, v model.BannerVariant) error {
+	log.Println("[DEBUG] db: update banner variant")
+
+	q := `UPDATE banner_variant SET content = $1, weight = $2 WHERE variant_id = $3 AND banner_id = $4;`
+	result, err := s.db(ctx).Exec(ctx, q, v.Content, v.Weight, v.ID, bannerID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Storage) GetBannerVariants(ctx context.Context, bannerID int) ([]model.BannerVariant, error) {
+	log.Println("[DEBUG] db: get banner variants")
+
+	q := `SELECT variant_id, content, weight FROM banner_variant WHERE banner_id = $1 ORDER BY variant_id;`
+	rows, err := s.db(ctx).Query(ctx, q, bannerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make([]model.BannerVariant, 0)
+	for rows.Next() {
+		var v model.BannerVariant
+		if err := rows.Scan(&v.ID, &v.Content, &v.Weight); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+func (s *Storage) DeleteBannerVariant(ctx context.Context, bannerID, variantID int) error {
+	log.Println("[DEBUG] db: delete banner variant")
+
+	q := `DELETE FROM banner_variant WHERE variant_id = $1 AND banner_id = $2;`
+	if _, err := s.db(ctx).Exec(ctx, q, variantID, bannerID); err != nil {
+		return err
+	}
+	return nil
+}
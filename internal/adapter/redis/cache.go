@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+const (
+	keyPrefix      = "banner:"
+	clearBatchSize = 1000
+)
+
+type Cache struct {
+	client *goredis.Client
+	ttl    time.Duration
+}
+
+func NewCache(cfg config.CacheConfig) (*Cache, error) {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     fmt.Sprintf("%s:%s", cfg.Redis.Host, cfg.Redis.Port),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Redis.Timeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	log.Println("successful redis connection")
+
+	return &Cache{client: client, ttl: cfg.TTL}, nil
+}
+
+func (c *Cache) Get(ctx context.Context, key model.BannerKey) (model.Banner, bool, error) {
+	data, err := c.client.Get(ctx, redisKey(key)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return model.Banner{}, false, nil
+	}
+	if err != nil {
+		return model.Banner{}, false, err
+	}
+
+	var b model.Banner
+	if err := json.Unmarshal(data, &b); err != nil {
+		return model.Banner{}, false, err
+	}
+	return b, true, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key model.BannerKey, b model.Banner) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	// запись должна истечь на границе окна показа, иначе баннер отдавался бы по устаревшему состоянию
+	now := time.Now()
+	return c.client.Set(ctx, redisKey(key), data, b.CacheExpiry(now, c.ttl).Sub(now)).Err()
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...model.BannerKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		redisKeys = append(redisKeys, redisKey(key))
+	}
+	return c.client.Del(ctx, redisKeys...).Err()
+}
+
+// Clear удаляет все баннеры. Ключи перебираются через SCAN, чтобы не блокировать redis на KEYS
+func (c *Cache) Clear(ctx context.Context) error {
+	iter := c.client.Scan(ctx, 0, keyPrefix+"*", clearBatchSize).Iterator()
+	batch := make([]string, 0, clearBatchSize)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == clearBatchSize {
+			if err := c.client.Del(ctx, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return c.client.Del(ctx, batch...).Err()
+	}
+	return nil
+}
+
+func (c *Cache) Close() error {
+	log.Println("[DEBUG] redis: close connection")
+
+	return c.client.Close()
+}
+
+func redisKey(key model.BannerKey) string {
+	return fmt.Sprintf("%s%d:%d", keyPrefix, key.TagID, key.FeatureID)
+}
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	srv := miniredis.RunT(t)
+	c, err := NewCache(config.CacheConfig{
+		TTL: time.Minute,
+		Redis: config.RedisConfig{
+			Host:    srv.Host(),
+			Port:    srv.Port(),
+			Timeout: time.Second,
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, srv
+}
+
+func TestCacheSetGet(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	key := model.BannerKey{TagID: 1, FeatureID: 2}
+
+	_, ok, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	banner := model.Banner{ID: 3, FeatureID: 2, Content: map[string]interface{}{"title": "test"}, IsActive: true}
+	require.NoError(t, c.Set(ctx, key, banner))
+
+	got, ok, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, banner.ID, got.ID)
+	assert.Equal(t, banner.Content, got.Content)
+	assert.True(t, got.IsActive)
+}
+
+func TestCacheExpiration(t *testing.T) {
+	c, srv := newTestCache(t)
+	ctx := context.Background()
+	key := model.BannerKey{TagID: 1, FeatureID: 2}
+
+	require.NoError(t, c.Set(ctx, key, model.Banner{ID: 3}))
+	srv.FastForward(2 * time.Minute)
+
+	_, ok, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCacheDelete(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	first := model.BannerKey{TagID: 1, FeatureID: 2}
+	second := model.BannerKey{TagID: 3, FeatureID: 2}
+
+	require.NoError(t, c.Set(ctx, first, model.Banner{ID: 1}))
+	require.NoError(t, c.Set(ctx, second, model.Banner{ID: 1}))
+	require.NoError(t, c.Delete(ctx, first, second))
+
+	for _, key := range []model.BannerKey{first, second} {
+		_, ok, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+}
+
+func TestCacheExpiresAtWindowBoundary(t *testing.T) {
+	c, srv := newTestCache(t)
+	ctx := context.Background()
+	key := model.BannerKey{TagID: 1, FeatureID: 2}
+
+	until := time.Now().Add(10 * time.Second)
+	require.NoError(t, c.Set(ctx, key, model.Banner{ID: 3, IsActive: true, ActiveUntil: &until}))
+	srv.FastForward(11 * time.Second)
+
+	_, ok, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCacheClear(t *testing.T) {
+	c, srv := newTestCache(t)
+	ctx := context.Background()
+
+	for tag := 1; tag <= 3; tag++ {
+		require.NoError(t, c.Set(ctx, model.BannerKey{TagID: tag, FeatureID: 2}, model.Banner{ID: tag}))
+	}
+	require.NoError(t, srv.Set("other", "value"))
+
+	require.NoError(t, c.Clear(ctx))
+
+	for tag := 1; tag <= 3; tag++ {
+		_, ok, err := c.Get(ctx, model.BannerKey{TagID: tag, FeatureID: 2})
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	assert.True(t, srv.Exists("other"), "keys of other owners must survive")
+}
@@ -13,11 +13,12 @@ var (
 	jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
 )
 
-func GenerateToken(tagID int, isAdmin bool) (string, error) {
+func GenerateToken(subject string, tagID int, isAdmin bool) (string, error) {
 	claims := &model.Claims{
 		TagID:   tagID,
 		IsAdmin: isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
 		},
 	}
@@ -2,6 +2,8 @@ package http
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -9,23 +11,41 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"golang.org/x/text/language"
 
 	"banner-service/internal/api/auth"
 	"banner-service/internal/model"
 )
 
-const adminID = 0
+const (
+	adminID   = 0
+	adminName = "admin"
+
+	// variantHeader сообщает клиенту, какой вариант баннера был показан
+	variantHeader = "X-Banner-Variant"
+)
 
 type BannerService interface {
 	AuthAction(ctx context.Context) (int, error)
-	GetUserBannerAction(context.Context, model.GetUserBannerParams) (interface{}, error)
-	GetFilteredBannersAction(context.Context, model.GetFilteredBannersParams) ([]model.BannerWithTags, error)
+	GetUserBannerAction(context.Context, model.GetUserBannerParams) (*model.UserBanner, error)
+	GetFilteredBannersAction(context.Context, model.GetFilteredBannersParams) (model.BannersPage, error)
 
 	CreateBannerAction(context.Context, model.BannerParams) (int, error)
 
 	PatchBannerAction(context.Context, int, model.BannerParams) error
 
+	GetBannerVersionsAction(context.Context, int) ([]model.BannerRevision, error)
+	GetBannerVersionAction(ctx context.Context, id int, version int) (model.BannerRevision, error)
+	RollbackBannerAction(ctx context.Context, id int, version int, author string) error
+
 	DeleteBannerAction(context.Context, int) error
+
+	ClickBannerAction(ctx context.Context, bannerID int, tagID int, variantID int) error
+	GetBannerStatsAction(context.Context, int) ([]model.BannerStats, error)
+
+	GetFeatureSchemaAction(ctx context.Context, featureID int) (model.FeatureSchema, error)
+	SetFeatureSchemaAction(ctx context.Context, featureID int, schema json.RawMessage) error
+	DeleteFeatureSchemaAction(ctx context.Context, featureID int) error
 }
 
 type Handler struct {
@@ -41,7 +61,14 @@ func (h *Handler) getUserToken(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	token, err := auth.GenerateToken(tagID, false)
+	// идентификатор пользователя нужен для стабильного выбора варианта баннера
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		if userID, err = newUserID(); err != nil {
+			return err
+		}
+	}
+	token, err := auth.GenerateToken(userID, tagID, false)
 	if err != nil {
 		return err
 	}
@@ -49,7 +76,11 @@ func (h *Handler) getUserToken(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (h *Handler) getAdminToken(w http.ResponseWriter, r *http.Request) error {
-	token, err := auth.GenerateToken(adminID, true)
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = adminName
+	}
+	token, err := auth.GenerateToken(name, adminID, true)
 	if err != nil {
 		return err
 	}
@@ -66,6 +97,8 @@ func (h *Handler) getUserBanner(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 	params.IsAdmin = claims.IsAdmin
+	params.UserID = claims.Subject
+	params.Query = r.URL.Query()
 
 	tagID := r.URL.Query().Get("tag_id")
 	if tagID == "" {
@@ -96,6 +129,17 @@ func (h *Handler) getUserBanner(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("%w: use_last_revision is bool", ErrValidationFailed)
 	}
 
+	// явный параметр lang важнее заголовка, а некорректный Accept-Language не должен ломать выдачу
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return fmt.Errorf("%w: lang must be a BCP 47 language tag", ErrValidationFailed)
+		}
+		params.Languages = []language.Tag{tag}
+	} else if header := r.Header.Get("Accept-Language"); header != "" {
+		params.Languages, _, _ = language.ParseAcceptLanguage(header)
+	}
+
 	log.Printf("tagID: %s; featureID: %s; useLastRevision: %s\n", tagID, featureID, useLastRevision)
 
 	if params.TagID != claims.TagID && !params.IsAdmin {
@@ -108,14 +152,16 @@ func (h *Handler) getUserBanner(w http.ResponseWriter, r *http.Request) error {
 	if result == nil {
 		return ErrNoPermission
 	}
-	return sendJSONResponse(w, result, http.StatusOK)
+	if result.VariantID != 0 {
+		w.Header().Set(variantHeader, strconv.Itoa(result.VariantID))
+	}
+	if result.Language != "" {
+		w.Header().Set("Content-Language", result.Language)
+	}
+	return sendJSONResponse(w, result.Content, http.StatusOK)
 }
 
 func (h *Handler) getFilteredBanners(w http.ResponseWriter, r *http.Request) error {
-	var (
-		params model.GetFilteredBannersParams
-		err    error
-	)
 	claims, err := authMiddleware(w, r)
 	if err != nil {
 		return err
@@ -124,42 +170,22 @@ func (h *Handler) getFilteredBanners(w http.ResponseWriter, r *http.Request) err
 		return ErrNoPermission
 	}
 
-	tagID := r.URL.Query().Get("tag_id")
-	if tagID != "" {
-		if params.TagID, err = strconv.Atoi(tagID); err != nil {
-			return fmt.Errorf("%w: %v", ErrValidationFailed, err)
-		}
-	}
-
-	featureID := r.URL.Query().Get("feature_id")
-	if featureID != "" {
-		if params.FeatureID, err = strconv.Atoi(featureID); err != nil {
-			return fmt.Errorf("%w: %v", ErrValidationFailed, err)
-		}
-	}
-
-	limit := r.URL.Query().Get("limit")
-	if limit != "" {
-		if params.Limit, err = strconv.Atoi(limit); err != nil || params.Limit < 0 {
-			return fmt.Errorf("%w: %v", ErrValidationFailed, err)
-		}
-	} else {
-		params.Limit = -1
+	params, err := parseFilteredBannersParams(r.URL.Query())
+	if err != nil {
+		return err
 	}
 
-	offset := r.URL.Query().Get("offset")
-	if offset != "" {
-		if params.Offset, err = strconv.Atoi(offset); err != nil || params.Offset < 0 {
-			return fmt.Errorf("%w: %v", ErrValidationFailed, err)
-		}
-	}
-	log.Printf("tagID: %s; featureID: %s; limit: %s; offset: %s\n", tagID, featureID, limit, offset)
+	log.Printf("filtered banners query: %s\n", r.URL.RawQuery)
 	result, err := h.service.GetFilteredBannersAction(r.Context(), params)
 	if err != nil {
 		return err
 	}
 
-	return sendJSONResponse(w, result, http.StatusOK)
+	// старые клиенты ожидают голый массив, обертка отдается только по запросу
+	if params.UseCursor || params.WithTotal {
+		return sendJSONResponse(w, result, http.StatusOK)
+	}
+	return sendJSONResponse(w, result.Items, http.StatusOK)
 }
 
 func (h *Handler) createBanner(w http.ResponseWriter, r *http.Request) error {
@@ -171,10 +197,11 @@ func (h *Handler) createBanner(w http.ResponseWriter, r *http.Request) error {
 		return ErrNoPermission
 	}
 
-	var params model.BannerParams
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return fmt.Errorf("%w: %s", ErrValidationFailed, err)
+	params, err := decodeBannerParams(r.Body, true)
+	if err != nil {
+		return err
 	}
+	params.Author = claims.Subject
 
 	id, err := h.service.CreateBannerAction(r.Context(), params)
 	if err != nil {
@@ -198,10 +225,11 @@ func (h *Handler) patchBanner(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
 	}
 
-	var params model.BannerParams
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	params, err := decodeBannerParams(r.Body, false)
+	if err != nil {
+		return err
 	}
+	params.Author = claims.Subject
 
 	if err := h.service.PatchBannerAction(r.Context(), id, params); err != nil {
 		return err
@@ -209,6 +237,78 @@ func (h *Handler) patchBanner(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (h *Handler) getBannerVersions(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	result, err := h.service.GetBannerVersionsAction(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	return sendJSONResponse(w, result, http.StatusOK)
+}
+
+func (h *Handler) getBannerVersion(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	result, err := h.service.GetBannerVersionAction(r.Context(), id, version)
+	if err != nil {
+		return err
+	}
+	return sendJSONResponse(w, result, http.StatusOK)
+}
+
+func (h *Handler) rollbackBanner(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		return fmt.Errorf("%w: version is required", ErrValidationFailed)
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	return h.service.RollbackBannerAction(r.Context(), id, n, claims.Subject)
+}
+
 func (h *Handler) deleteBanner(w http.ResponseWriter, r *http.Request) error {
 	claims, err := authMiddleware(w, r)
 	if err != nil {
@@ -229,3 +329,122 @@ func (h *Handler) deleteBanner(w http.ResponseWriter, r *http.Request) error {
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+func (h *Handler) getFeatureSchema(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	featureID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	result, err := h.service.GetFeatureSchemaAction(r.Context(), featureID)
+	if err != nil {
+		return err
+	}
+	return sendJSONResponse(w, result, http.StatusOK)
+}
+
+func (h *Handler) setFeatureSchema(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	featureID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	var schema json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	return h.service.SetFeatureSchemaAction(r.Context(), featureID, schema)
+}
+
+func (h *Handler) deleteFeatureSchema(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	featureID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	if err := h.service.DeleteFeatureSchemaAction(r.Context(), featureID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func newUserID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (h *Handler) clickBanner(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	// вариант берется из заголовка X-Banner-Variant ответа /user_banner
+	variantID := 0
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		if variantID, err = strconv.Atoi(v); err != nil || variantID < 0 {
+			return fmt.Errorf("%w: variant_id must be non-negative integer", ErrValidationFailed)
+		}
+	}
+
+	if err := h.service.ClickBannerAction(r.Context(), id, claims.TagID, variantID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (h *Handler) getBannerStats(w http.ResponseWriter, r *http.Request) error {
+	claims, err := authMiddleware(w, r)
+	if err != nil {
+		return err
+	}
+	if !claims.IsAdmin {
+		return ErrNoPermission
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrValidationFailed, err)
+	}
+
+	result, err := h.service.GetBannerStatsAction(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	return sendJSONResponse(w, result, http.StatusOK)
+}
@@ -24,10 +24,23 @@ var (
 func errorsMiddleware(handler func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := handler(w, r)
+		var alreadyExists *service.ErrAlreadyExists
+		var validationErrs ValidationErrors
+		var invalidContent *service.ErrInvalidContent
 		switch {
 		case err == nil:
 			return
-		case errors.Is(err, ErrValidationFailed) || errors.Is(err, service.ErrAlreadyExists):
+		case errors.As(err, &validationErrs):
+			_ = sendJSONResponse(w, map[string]interface{}{"errors": validationErrs}, http.StatusBadRequest)
+		case errors.As(err, &alreadyExists):
+			_ = sendJSONResponse(w, map[string]interface{}{
+				"error":     err.Error(),
+				"banner_id": alreadyExists.BannerID,
+			}, http.StatusBadRequest)
+		case errors.As(err, &invalidContent):
+			_ = sendJSONResponse(w, map[string]interface{}{"errors": contentErrors(invalidContent)}, http.StatusBadRequest)
+		case errors.Is(err, ErrValidationFailed) || errors.Is(err, service.ErrInvalidSchema) ||
+			errors.Is(err, service.ErrInvalidVariant) || errors.Is(err, service.ErrLocalizedVariants):
 			_ = sendJSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
 		case errors.Is(err, ErrUnauthorized):
 			w.WriteHeader(http.StatusUnauthorized)
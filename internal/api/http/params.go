@@ -0,0 +1,125 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"banner-service/internal/model"
+)
+
+func parseFilteredBannersParams(query url.Values) (model.GetFilteredBannersParams, error) {
+	var (
+		params = model.GetFilteredBannersParams{Limit: -1, SortBy: model.SortByUpdatedAt}
+		err    error
+	)
+
+	if params.TagIDs, err = parseIntList(query, "tag_id"); err != nil {
+		return params, err
+	}
+	if params.FeatureIDs, err = parseIntList(query, "feature_id"); err != nil {
+		return params, err
+	}
+
+	if isActive := query.Get("is_active"); isActive != "" {
+		v, err := strconv.ParseBool(isActive)
+		if err != nil {
+			return params, fmt.Errorf("%w: is_active is bool", ErrValidationFailed)
+		}
+		params.IsActive = &v
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_from": &params.CreatedFrom,
+		"created_to":   &params.CreatedTo,
+		"updated_from": &params.UpdatedFrom,
+		"updated_to":   &params.UpdatedTo,
+	} {
+		if *dst, err = parseTime(query, name); err != nil {
+			return params, err
+		}
+	}
+
+	switch sortBy := query.Get("sort_by"); sortBy {
+	case "":
+	case model.SortByID, model.SortByCreatedAt, model.SortByUpdatedAt:
+		params.SortBy = sortBy
+	default:
+		return params, fmt.Errorf("%w: sort_by must be one of id, created_at, updated_at", ErrValidationFailed)
+	}
+	switch sortOrder := query.Get("sort_order"); sortOrder {
+	case "", "asc":
+	case "desc":
+		params.SortDesc = true
+	default:
+		return params, fmt.Errorf("%w: sort_order must be asc or desc", ErrValidationFailed)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil || params.Limit < 0 {
+			return params, fmt.Errorf("%w: limit must be a non-negative integer", ErrValidationFailed)
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil || params.Offset < 0 {
+			return params, fmt.Errorf("%w: offset must be a non-negative integer", ErrValidationFailed)
+		}
+	}
+
+	if withTotal := query.Get("with_total"); withTotal != "" {
+		if params.WithTotal, err = strconv.ParseBool(withTotal); err != nil {
+			return params, fmt.Errorf("%w: with_total is bool", ErrValidationFailed)
+		}
+	}
+
+	// наличие параметра cursor, даже пустого, включает постраничный обход по курсору
+	params.UseCursor = query.Has("cursor")
+	if params.UseCursor && params.Offset != 0 {
+		return params, fmt.Errorf("%w: cursor and offset are mutually exclusive", ErrValidationFailed)
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := model.DecodeBannerCursor(cursor)
+		if err != nil {
+			return params, fmt.Errorf("%w: %v", ErrValidationFailed, err)
+		}
+		if c.SortBy != params.SortBy || c.SortDesc != params.SortDesc {
+			return params, fmt.Errorf("%w: cursor was issued for a different sort order", ErrValidationFailed)
+		}
+		params.Cursor = &c
+	}
+
+	return params, nil
+}
+
+// parseIntList разбирает параметр, переданный несколько раз или через запятую: tag_id=1&tag_id=2 или tag_id=1,2
+func parseIntList(query url.Values, name string) ([]int, error) {
+	var result []int
+	for _, value := range query[name] {
+		for _, part := range strings.Split(value, ",") {
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s must be a list of integers", ErrValidationFailed, name)
+			}
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+func parseTime(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be RFC 3339 date-time", ErrValidationFailed, name)
+	}
+	t = t.UTC()
+	return &t, nil
+}
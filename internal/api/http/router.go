@@ -19,6 +19,14 @@ func InitRouter(h *Handler) http.Handler {
 	router.Post("/banner", errorsMiddleware(h.createBanner))
 	router.Patch("/banner/{id}", errorsMiddleware(h.patchBanner))
 	router.Delete("/banner/{id}", errorsMiddleware(h.deleteBanner))
+	router.Get("/banner/{id}/versions", errorsMiddleware(h.getBannerVersions))
+	router.Get("/banner/{id}/versions/{version}", errorsMiddleware(h.getBannerVersion))
+	router.Post("/banner/{id}/rollback", errorsMiddleware(h.rollbackBanner))
+	router.Post("/banner/{id}/click", errorsMiddleware(h.clickBanner))
+	router.Get("/banner/{id}/stats", errorsMiddleware(h.getBannerStats))
+	router.Get("/feature/{id}/schema", errorsMiddleware(h.getFeatureSchema))
+	router.Put("/feature/{id}/schema", errorsMiddleware(h.setFeatureSchema))
+	router.Delete("/feature/{id}/schema", errorsMiddleware(h.deleteFeatureSchema))
 
 	return router
 }
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"banner-service/internal/model"
+	"banner-service/internal/service"
+)
+
+// FieldError описывает ошибку валидации конкретного поля запроса.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors - набор ошибок валидации, отдается клиенту целиком.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ValidationErrors) Unwrap() error {
+	return ErrValidationFailed
+}
+
+// decodeBannerParams читает тело запроса создания/изменения баннера и проверяет его.
+// При создании обязательны tag_ids, feature_id и content. Локали в localized_content
+// приводятся к каноничному виду BCP 47.
+func decodeBannerParams(body io.Reader, create bool) (model.BannerParams, error) {
+	var params model.BannerParams
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&params); err != nil {
+		return params, ValidationErrors{decodeError(err)}
+	}
+	if dec.More() {
+		return params, ValidationErrors{{Field: "body", Message: "unexpected data after JSON object"}}
+	}
+
+	if errs := validateBannerParams(params, create); len(errs) > 0 {
+		return params, errs
+	}
+	if params.LocalizedContent != nil {
+		canonical := make(map[string]interface{}, len(*params.LocalizedContent))
+		for locale, content := range *params.LocalizedContent {
+			canonical[language.Make(locale).String()] = content
+		}
+		params.LocalizedContent = &canonical
+	}
+	return params, nil
+}
+
+func validateBannerParams(p model.BannerParams, create bool) ValidationErrors {
+	var errs ValidationErrors
+
+	switch {
+	case p.TagIDs == nil:
+		if create {
+			errs = append(errs, FieldError{Field: "tag_ids", Message: "is required"})
+		}
+	case len(*p.TagIDs) == 0:
+		errs = append(errs, FieldError{Field: "tag_ids", Message: "must not be empty"})
+	default:
+		seen := make(map[int]struct{}, len(*p.TagIDs))
+		for _, tagID := range *p.TagIDs {
+			if tagID <= 0 {
+				errs = append(errs, FieldError{Field: "tag_ids", Message: fmt.Sprintf("tag id %d must be positive", tagID)})
+				continue
+			}
+			if _, ok := seen[tagID]; ok {
+				errs = append(errs, FieldError{Field: "tag_ids", Message: fmt.Sprintf("tag id %d is duplicated", tagID)})
+				continue
+			}
+			seen[tagID] = struct{}{}
+		}
+	}
+
+	switch {
+	case p.FeatureID == nil:
+		if create {
+			errs = append(errs, FieldError{Field: "feature_id", Message: "is required"})
+		}
+	case *p.FeatureID <= 0:
+		errs = append(errs, FieldError{Field: "feature_id", Message: "must be positive"})
+	}
+
+	if p.Content == nil && create {
+		errs = append(errs, FieldError{Field: "content", Message: "must not be null"})
+	}
+
+	if p.LocalizedContent != nil {
+		locales := make([]string, 0, len(*p.LocalizedContent))
+		for locale := range *p.LocalizedContent {
+			locales = append(locales, locale)
+		}
+		sort.Strings(locales)
+
+		seen := make(map[string]string, len(locales))
+		for _, locale := range locales {
+			content := (*p.LocalizedContent)[locale]
+			field := "localized_content/" + locale
+			tag, err := language.Parse(locale)
+			if err != nil {
+				errs = append(errs, FieldError{Field: field, Message: "locale must be a BCP 47 language tag"})
+				continue
+			}
+			if other, ok := seen[tag.String()]; ok {
+				errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("same locale as %q", other)})
+			}
+			seen[tag.String()] = locale
+			if content == nil {
+				errs = append(errs, FieldError{Field: field, Message: "must not be null"})
+			}
+		}
+	}
+
+	if p.Variants != nil {
+		seen := make(map[int]struct{}, len(*p.Variants))
+		for i, v := range *p.Variants {
+			switch _, duplicated := seen[v.ID]; {
+			case v.ID == 0:
+			case create:
+				errs = append(errs, FieldError{Field: fmt.Sprintf("variants/%d/variant_id", i), Message: "must not be set on create"})
+			case v.ID < 0:
+				errs = append(errs, FieldError{Field: fmt.Sprintf("variants/%d/variant_id", i), Message: "must be positive"})
+			case duplicated:
+				errs = append(errs, FieldError{Field: fmt.Sprintf("variants/%d/variant_id", i), Message: "is duplicated"})
+			default:
+				seen[v.ID] = struct{}{}
+			}
+			if v.Content == nil {
+				errs = append(errs, FieldError{Field: fmt.Sprintf("variants/%d/content", i), Message: "must not be null"})
+			}
+			if v.Weight <= 0 {
+				errs = append(errs, FieldError{Field: fmt.Sprintf("variants/%d/weight", i), Message: "must be positive"})
+			}
+		}
+	}
+
+	if p.LocalizedContent != nil && len(*p.LocalizedContent) > 0 && p.Variants != nil && len(*p.Variants) > 0 {
+		errs = append(errs, FieldError{Field: "localized_content", Message: "can not be combined with variants"})
+	}
+
+	if p.ActiveFrom.Invalid != "" {
+		errs = append(errs, FieldError{Field: "active_from", Message: "must be RFC 3339 date-time"})
+	}
+	if p.ActiveUntil.Invalid != "" {
+		errs = append(errs, FieldError{Field: "active_until", Message: "must be RFC 3339 date-time"})
+	}
+	if from, until := p.ActiveFrom.Time, p.ActiveUntil.Time; from != nil && until != nil && !until.After(*from) {
+		errs = append(errs, FieldError{Field: "active_until", Message: "must be after active_from"})
+	}
+
+	return errs
+}
+
+func decodeError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return FieldError{Field: typeErr.Field, Message: fmt.Sprintf("must be %s", typeErr.Type)}
+	case errors.As(err, &syntaxErr):
+		return FieldError{Field: "body", Message: "malformed JSON"}
+	case errors.Is(err, io.EOF):
+		return FieldError{Field: "body", Message: "is empty"}
+	}
+
+	// для неизвестных полей encoding/json не возвращает типизированную ошибку
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(name, `"`), Message: "unknown field"}
+	}
+	return FieldError{Field: "body", Message: err.Error()}
+}
+
+// contentErrors переводит нарушения схемы фичи в ошибки полей. Путь внутри содержимого
+// дописывается к имени поля как JSON Pointer, например content/buttons/0/url
+func contentErrors(err *service.ErrInvalidContent) ValidationErrors {
+	errs := make(ValidationErrors, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		errs = append(errs, FieldError{Field: err.Field + v.Path, Message: v.Message})
+	}
+	return errs
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBannerParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		create bool
+		fields []string
+	}{
+		{
+			name:   "valid create",
+			body:   `{"tag_ids":[1,2],"feature_id":3,"content":{"title":"t"},"is_active":true}`,
+			create: true,
+		},
+		{
+			name:   "missing fields on create",
+			body:   `{}`,
+			create: true,
+			fields: []string{"tag_ids", "feature_id", "content"},
+		},
+		{
+			name:   "empty tags and zero feature",
+			body:   `{"tag_ids":[],"feature_id":0,"content":{}}`,
+			create: true,
+			fields: []string{"tag_ids", "feature_id"},
+		},
+		{
+			name:   "negative and duplicated tags",
+			body:   `{"tag_ids":[1,-1,1]}`,
+			fields: []string{"tag_ids", "tag_ids"},
+		},
+		{
+			name:   "unknown field",
+			body:   `{"tag_id":1}`,
+			fields: []string{"tag_id"},
+		},
+		{
+			name:   "wrong type",
+			body:   `{"feature_id":"1"}`,
+			fields: []string{"feature_id"},
+		},
+		{
+			name:   "window boundaries out of order",
+			body:   `{"active_from":"2024-05-01T00:00:00Z","active_until":"2024-04-01T00:00:00Z"}`,
+			fields: []string{"active_until"},
+		},
+		{
+			name:   "malformed time",
+			body:   `{"active_from":"tomorrow"}`,
+			fields: []string{"active_from"},
+		},
+		{
+			name:   "malformed window boundaries",
+			body:   `{"active_from":"tomorrow","active_until":1}`,
+			fields: []string{"active_from", "active_until"},
+		},
+		{
+			name: "clear window",
+			body: `{"active_from":null,"active_until":null}`,
+		},
+		{
+			name:   "invalid variants",
+			body:   `{"variants":[{"content":{"title":"a"},"weight":1},{"weight":0}]}`,
+			fields: []string{"variants/1/content", "variants/1/weight"},
+		},
+		{
+			name:   "invalid variant ids",
+			body:   `{"variants":[{"variant_id":3,"content":{},"weight":1},{"variant_id":3,"content":{},"weight":1},{"variant_id":-1,"content":{},"weight":1}]}`,
+			fields: []string{"variants/1/variant_id", "variants/2/variant_id"},
+		},
+		{
+			name:   "variant id on create",
+			body:   `{"tag_ids":[1],"feature_id":1,"content":{},"variants":[{"variant_id":3,"content":{},"weight":1}]}`,
+			create: true,
+			fields: []string{"variants/0/variant_id"},
+		},
+		{
+			name:   "invalid locales",
+			body:   `{"localized_content":{"en":{"title":"a"},"en-US":null,"not a locale":{}}}`,
+			fields: []string{"localized_content/en-US", "localized_content/not a locale"},
+		},
+		{
+			name:   "locales with variants",
+			body:   `{"localized_content":{"en":{"title":"a"}},"variants":[{"content":{"title":"b"},"weight":1}]}`,
+			fields: []string{"localized_content"},
+		},
+		{
+			name: "remove locales and set variants",
+			body: `{"localized_content":{},"variants":[{"content":{"title":"b"},"weight":1}]}`,
+		},
+		{
+			name: "partial patch",
+			body: `{"is_active":false}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeBannerParams(strings.NewReader(tt.body), tt.create)
+			if len(tt.fields) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var errs ValidationErrors
+			require.ErrorAs(t, err, &errs)
+			assert.ErrorIs(t, err, ErrValidationFailed)
+
+			fields := make([]string, 0, len(errs))
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestDecodeBannerParamsCanonicalizesLocales(t *testing.T) {
+	params, err := decodeBannerParams(strings.NewReader(`{"localized_content":{"pt-br":{"title":"a"}}}`), false)
+	require.NoError(t, err)
+	require.NotNil(t, params.LocalizedContent)
+	assert.Contains(t, *params.LocalizedContent, "pt-BR")
+}
@@ -2,16 +2,20 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 
+	"banner-service/internal/adapter/memory"
 	"banner-service/internal/adapter/postgres"
+	"banner-service/internal/adapter/redis"
 	api "banner-service/internal/api/http"
 	"banner-service/internal/config"
 	"banner-service/internal/service"
@@ -32,7 +36,21 @@ func Start() error {
 	if err != nil {
 		return err
 	}
-	serv := service.NewService(db)
+	cache, err := initCache(cfg.Cache)
+	if err != nil {
+		return err
+	}
+	stats := service.NewStatsWriter(db, cfg.Stats.BufferSize, cfg.Stats.BatchSize)
+	serv := service.NewService(db, cache, stats, service.NewRenderer(cfg.Templates.QueryParams))
+	if err = serv.WarmUpCache(context.Background()); err != nil {
+		return err
+	}
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go serv.RunCacheRefresher(bgCtx, cfg.Cache.RefreshInterval)
+	go postgres.NewListener(cfg.Database).Listen(bgCtx, serv.InvalidateCache, serv.ResyncCache)
+	go stats.Run(bgCtx, cfg.Stats.FlushInterval)
+
 	handler := api.NewHandler(serv)
 
 	httpServer := initHTTPServer(cfg.Server, handler)
@@ -40,7 +58,7 @@ func Start() error {
 	log.Printf("starting HTTP server on %s", httpServer.Addr)
 
 	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("failed listen and serve: %v", err)
 		}
 	}()
@@ -52,6 +70,13 @@ func Start() error {
 	if err := httpServer.Shutdown(context.Background()); err != nil {
 		return err
 	}
+	log.Println("shut down background jobs")
+	stopBackground()
+	<-stats.Done()
+	log.Println("shut down cache")
+	if err := cache.Close(); err != nil {
+		return err
+	}
 	log.Println("shut down database")
 	if err := db.Close(context.Background()); err != nil {
 		return err
@@ -66,12 +91,74 @@ func initStorage(cfg config.PostgresConfig) (*postgres.Storage, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err = db.Init(context.Background()); err != nil {
+	statuses, err := db.MigrationsStatus(context.Background())
+	if err != nil {
 		return nil, err
 	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			return nil, fmt.Errorf("migration %04d_%s is not applied, run `banner-service migrate up`",
+				status.Version, status.Name)
+		}
+	}
 	return db, nil
 }
 
+// Migrate выполняет подкоманду migrate: up накатывает все миграции, down откатывает последнюю,
+// status выводит список миграций
+func Migrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: banner-service migrate up|down|status")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	db, err := postgres.NewStorage(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close(context.Background())
+	}()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		return db.MigrateUp(ctx)
+	case "down":
+		return db.MigrateDown(ctx)
+	case "status":
+		statuses, err := db.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
+func initCache(cfg config.CacheConfig) (service.Cache, error) {
+	log.Printf("init %s cache", cfg.Type)
+	switch cfg.Type {
+	case "memory":
+		return memory.NewCache(cfg), nil
+	case "redis":
+		return redis.NewCache(cfg)
+	default:
+		return nil, fmt.Errorf("unknown cache type: %s", cfg.Type)
+	}
+}
+
 func initHTTPServer(cfg config.HTTPConfig, handler *api.Handler) *http.Server {
 	log.Println("init http server")
 	return &http.Server{
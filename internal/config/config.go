@@ -10,8 +10,11 @@ import (
 )
 
 type Config struct {
-	Server   HTTPConfig     `yaml:"server"`
-	Database PostgresConfig `yaml:"postgres"`
+	Server    HTTPConfig      `yaml:"server"`
+	Database  PostgresConfig  `yaml:"postgres"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Stats     StatsConfig     `yaml:"stats"`
+	Templates TemplatesConfig `yaml:"templates"`
 }
 
 type HTTPConfig struct {
@@ -25,6 +28,38 @@ type PostgresConfig struct {
 	Password string        `yaml:"password"`
 	Database string        `yaml:"database"`
 	Timeout  time.Duration `yaml:"timeout"`
+
+	MaxConns          int32         `yaml:"max_conns" env-default:"20"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" env-default:"5m"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" env-default:"1m"`
+}
+
+type CacheConfig struct {
+	Type            string        `yaml:"type" env-default:"memory"`
+	TTL             time.Duration `yaml:"ttl" env-default:"5m"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1m"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"1m"`
+	Redis           RedisConfig   `yaml:"redis"`
+}
+
+type RedisConfig struct {
+	Host     string        `yaml:"host"`
+	Port     string        `yaml:"port"`
+	Password string        `yaml:"password"`
+	DB       int           `yaml:"db"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+// StatsConfig настраивает запись показов и кликов: события копятся в буфере и пишутся пачками
+type StatsConfig struct {
+	BufferSize    int           `yaml:"buffer_size" env-default:"10000"`
+	BatchSize     int           `yaml:"batch_size" env-default:"1000"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"5s"`
+}
+
+// TemplatesConfig задает параметры запроса /user_banner, которые можно подставлять в содержимое как query.<name>
+type TemplatesConfig struct {
+	QueryParams []string `yaml:"query_params"`
 }
 
 func Load() (Config, error) {
@@ -7,11 +7,90 @@ type Banner struct {
 	FeatureID int         `json:"feature_id"`
 	Content   interface{} `json:"content"`
 	IsActive  bool        `json:"is_active"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+
+	// LocalizedContent - содержимое по локалям (BCP 47). Content отдается, если подходящей локали нет
+	LocalizedContent map[string]interface{} `json:"localized_content,omitempty"`
+
+	ActiveFrom  *time.Time `json:"active_from"`
+	ActiveUntil *time.Time `json:"active_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Variants []BannerVariant `json:"variants,omitempty"`
+}
+
+// BannerVariant - вариант содержимого баннера для A/B-тестов. Доля пользователей,
+// получающих вариант, пропорциональна его весу
+type BannerVariant struct {
+	ID      int         `json:"variant_id"`
+	Content interface{} `json:"content"`
+	Weight  int         `json:"weight"`
+}
+
+// UserBanner - содержимое, выбранное для конкретного пользователя.
+// VariantID равен 0, если у баннера нет вариантов, Language пуст, если отдано содержимое по умолчанию
+type UserBanner struct {
+	Content   interface{}
+	VariantID int
+	Language  string
+}
+
+// IsActiveAt сообщает, показывается ли баннер в момент t: флаг is_active должен быть поднят,
+// а t - попадать в окно [active_from, active_until). Незаданная граница окно не ограничивает
+func (b Banner) IsActiveAt(t time.Time) bool {
+	if !b.IsActive {
+		return false
+	}
+	if b.ActiveFrom != nil && t.Before(*b.ActiveFrom) {
+		return false
+	}
+	if b.ActiveUntil != nil && !t.Before(*b.ActiveUntil) {
+		return false
+	}
+	return true
+}
+
+// CacheExpiry возвращает момент, до которого баннер можно держать в кэше: через ttl после now,
+// но не позже ближайшей границы окна показа, после которой меняется результат IsActiveAt
+func (b Banner) CacheExpiry(now time.Time, ttl time.Duration) time.Time {
+	expiry := now.Add(ttl)
+	for _, boundary := range []*time.Time{b.ActiveFrom, b.ActiveUntil} {
+		if boundary != nil && boundary.After(now) && boundary.Before(expiry) {
+			expiry = *boundary
+		}
+	}
+	return expiry
 }
 
 type BannerWithTags struct {
 	Banner
 	Tags []int `json:"tag_ids"`
 }
+
+type BannersPage struct {
+	Items      []BannerWithTags `json:"items"`
+	Total      *int             `json:"total,omitempty"`
+	Limit      *int             `json:"limit,omitempty"`
+	Offset     int              `json:"offset"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type BannerKey struct {
+	TagID     int `json:"tag_id"`
+	FeatureID int `json:"feature_id"`
+}
+
+type BannerRevision struct {
+	BannerID  int         `json:"banner_id"`
+	Version   int         `json:"version"`
+	FeatureID int         `json:"feature_id"`
+	Tags      []int       `json:"tag_ids"`
+	Content   interface{} `json:"content"`
+	IsActive  bool        `json:"is_active"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Author    string      `json:"author"`
+
+	// LocalizedContent и Variants равны nil у версий, записанных до того, как их начали сохранять
+	LocalizedContent map[string]interface{} `json:"localized_content"`
+	Variants         []BannerVariant        `json:"variants"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBannerIsActiveAt(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		banner Banner
+		want   bool
+	}{
+		{name: "no window", banner: Banner{IsActive: true}, want: true},
+		{name: "disabled", banner: Banner{IsActive: false}, want: false},
+		{name: "inside window", banner: Banner{IsActive: true, ActiveFrom: &before, ActiveUntil: &after}, want: true},
+		{name: "not started", banner: Banner{IsActive: true, ActiveFrom: &after}, want: false},
+		{name: "finished", banner: Banner{IsActive: true, ActiveUntil: &before}, want: false},
+		{name: "until is exclusive", banner: Banner{IsActive: true, ActiveUntil: &now}, want: false},
+		{name: "from is inclusive", banner: Banner{IsActive: true, ActiveFrom: &now}, want: true},
+		{name: "disabled inside window", banner: Banner{ActiveFrom: &before, ActiveUntil: &after}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.banner.IsActiveAt(now))
+		})
+	}
+}
+
+func TestBannerCacheExpiry(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 5 * time.Minute
+	soon, later, past := now.Add(time.Minute), now.Add(time.Hour), now.Add(-time.Minute)
+
+	assert.Equal(t, now.Add(ttl), Banner{}.CacheExpiry(now, ttl))
+	assert.Equal(t, soon, Banner{ActiveFrom: &soon}.CacheExpiry(now, ttl))
+	assert.Equal(t, soon, Banner{ActiveFrom: &past, ActiveUntil: &soon}.CacheExpiry(now, ttl))
+	assert.Equal(t, now.Add(ttl), Banner{ActiveUntil: &later}.CacheExpiry(now, ttl))
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// BannerCursor указывает на последний баннер страницы в порядке (поле сортировки, id).
+// Клиентам отдается в виде непрозрачной строки
+type BannerCursor struct {
+	SortBy   string    `json:"s"`
+	SortDesc bool      `json:"d,omitempty"`
+	Value    time.Time `json:"u"`
+	ID       int       `json:"i"`
+}
+
+func NewBannerCursor(b Banner, sortBy string, sortDesc bool) BannerCursor {
+	c := BannerCursor{SortBy: sortBy, SortDesc: sortDesc, ID: b.ID}
+	switch sortBy {
+	case SortByCreatedAt:
+		c.Value = b.CreatedAt
+	case SortByUpdatedAt:
+		c.Value = b.UpdatedAt
+	}
+	return c
+}
+
+func (c BannerCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeBannerCursor(s string) (BannerCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return BannerCursor{}, ErrInvalidCursor
+	}
+	var c BannerCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return BannerCursor{}, ErrInvalidCursor
+	}
+	switch c.SortBy {
+	case SortByID, SortByCreatedAt, SortByUpdatedAt:
+		return c, nil
+	default:
+		return BannerCursor{}, ErrInvalidCursor
+	}
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBannerCursorRoundTrip(t *testing.T) {
+	banner := Banner{ID: 42, CreatedAt: time.Date(2024, 4, 10, 12, 30, 0, 123456000, time.UTC)}
+	cursor := NewBannerCursor(banner, SortByCreatedAt, true)
+
+	decoded, err := DecodeBannerCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, banner.CreatedAt.Equal(decoded.Value))
+	assert.Equal(t, banner.ID, decoded.ID)
+	assert.Equal(t, SortByCreatedAt, decoded.SortBy)
+	assert.True(t, decoded.SortDesc)
+}
+
+func TestDecodeInvalidBannerCursor(t *testing.T) {
+	cursors := []string{
+		"not base64!",
+		"e30",
+		"bnVsbA",
+		"eyJ1IjoiMjAyNC0wNC0xMFQxMjozMDowMFoiLCJpIjoxfQ", // {"u":"2024-04-10T12:30:00Z","i":1}: нет поля сортировки
+		"eyJzIjoidGl0bGUiLCJpIjoxfQ",                     // {"s":"title","i":1}: неизвестное поле сортировки
+	}
+	for _, s := range cursors {
+		_, err := DecodeBannerCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
@@ -0,0 +1,13 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FeatureSchema - JSON Schema, которой должно соответствовать содержимое баннеров фичи
+type FeatureSchema struct {
+	FeatureID int             `json:"feature_id"`
+	Schema    json.RawMessage `json:"schema"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
@@ -1,22 +1,98 @@
 package model
 
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
 type GetUserBannerParams struct {
-	TagID           int
-	FeatureID       int
+	TagID     int
+	FeatureID int
+	UserID    string
+	// Languages - предпочитаемые пользователем языки в порядке убывания приоритета
+	Languages []language.Tag
+	// Query - параметры запроса, доступные шаблонам содержимого как query.<name>
+	Query           url.Values
 	UseLastRevision bool
 	IsAdmin         bool
 }
 
+const (
+	SortByID        = "id"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
 type GetFilteredBannersParams struct {
-	TagID     int
-	FeatureID int
-	Limit     int
-	Offset    int
+	TagIDs      []int
+	FeatureIDs  []int
+	IsActive    *bool
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+	UseCursor   bool
+	Cursor      *BannerCursor
+	WithTotal   bool
 }
 
+// BannerParams — тело запросов на создание и изменение баннера.
+// Nil означает, что поле не передано: при изменении такие поля остаются прежними.
+// Границы окна показа можно снять явным null, поэтому для них отсутствие и null различаются
 type BannerParams struct {
-	TagIDs    []int       `json:"tag_ids"`
-	FeatureID int         `json:"feature_id"`
+	TagIDs    *[]int      `json:"tag_ids"`
+	FeatureID *int        `json:"feature_id"`
 	Content   interface{} `json:"content"`
-	IsActive  bool        `json:"is_active"`
+	// LocalizedContent целиком заменяет содержимое по локалям, пустой объект удаляет его
+	LocalizedContent *map[string]interface{} `json:"localized_content"`
+	IsActive         *bool                   `json:"is_active"`
+	ActiveFrom       NullableTime            `json:"active_from"`
+	ActiveUntil      NullableTime            `json:"active_until"`
+	// Variants целиком заменяет набор вариантов баннера, пустой список удаляет их.
+	// Варианты с variant_id обновляются на месте, без него - создаются заново
+	Variants *[]BannerVariantParams `json:"variants"`
+	Author   string                 `json:"-"`
+}
+
+// BannerVariantParams описывает вариант в запросе. ID - существующий вариант баннера, 0 - новый вариант
+type BannerVariantParams struct {
+	ID      int         `json:"variant_id"`
+	Content interface{} `json:"content"`
+	Weight  int         `json:"weight"`
+}
+
+// NullableTime - необязательное поле времени, в котором явный null отличается от отсутствия поля.
+// Set == true, если поле было в запросе, Time == nil, если в нем передан null.
+// Значение, которое не удалось разобрать, сохраняется в Invalid: декодер не сообщает имя поля
+// для ошибок из UnmarshalJSON, поэтому ошибку по нему выдает валидация запроса
+type NullableTime struct {
+	Set     bool
+	Time    *time.Time
+	Invalid string
+}
+
+func (n *NullableTime) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Time = nil
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		n.Invalid = string(data)
+		return nil
+	}
+	n.Time = &t
+	return nil
+}
+
+func (n NullableTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.Time)
 }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type BannerEventType int
+
+const (
+	EventImpression BannerEventType = iota
+	EventClick
+)
+
+// BannerEvent - показ или клик по баннеру. VariantID равен 0, если у баннера нет вариантов
+type BannerEvent struct {
+	Type      BannerEventType
+	BannerID  int
+	TagID     int
+	VariantID int
+	Time      time.Time
+}
+
+// BannerStats - число показов и кликов баннера за день (начало дня по UTC) в разрезе тега и варианта
+type BannerStats struct {
+	BannerID    int       `json:"-"`
+	Day         time.Time `json:"day"`
+	TagID       int       `json:"tag_id"`
+	VariantID   int       `json:"variant_id"`
+	Impressions int       `json:"impressions"`
+	Clicks      int       `json:"clicks"`
+}
@@ -2,202 +2,553 @@ package service
 
 import (
 	"context"
-	"errors"
 	"log"
 	"math/rand/v2"
 	"time"
 
-	"github.com/jackc/pgx/v5"
-
 	"banner-service/internal/model"
 )
 
 type BannerStorage interface {
 	GetUserBanner(ctx context.Context, tagID int, featureID int) (model.Banner, error)
-	GetBannersByFeature(context.Context, int) ([]model.Banner, error)
-	GetBannersByTag(context.Context, int) ([]model.Banner, error)
+	GetBannerByID(context.Context, int) (model.Banner, error)
+	GetBannerByIDForUpdate(context.Context, int) (model.Banner, error)
+	GetFilteredBanners(context.Context, model.GetFilteredBannersParams) ([]model.BannerWithTags, error)
+	CountBanners(context.Context, model.GetFilteredBannersParams) (int, error)
 	GetTagsByBannerID(context.Context, int) ([]int, error)
-	GetAllBanners(context.Context) ([]model.Banner, error)
 	GetAllTags(context.Context) ([]int, error)
+	GetBannerRevisions(context.Context, int) ([]model.BannerRevision, error)
+	GetBannerRevision(ctx context.Context, bannerID int, version int) (model.BannerRevision, error)
+	GetFeatureSchema(ctx context.Context, featureID int) (model.FeatureSchema, error)
+	GetBannerVariants(ctx context.Context, bannerID int) ([]model.BannerVariant, error)
+	GetBannerStats(ctx context.Context, bannerID int) ([]model.BannerStats, error)
 
-	CreateBanner(context.Context, model.Banner) error
+	CreateBanner(context.Context, model.Banner) (int, error)
 	CreateTag(context.Context, int) error
 	CreateBannerTagLock(context.Context, int, int) error
+	CreateBannerRevision(context.Context, model.BannerRevision) (int, error)
+	SetFeatureSchema(context.Context, model.FeatureSchema) error
+	CreateBannerVariant(ctx context.Context, bannerID int, v model.BannerVariant) (int, error)
+	UpdateBannerVariant(ctx context.Context, bannerID int, v model.BannerVariant) error
 
 	PatchBanner(context.Context, model.Banner) error
 
 	DeleteBanner(context.Context, int) error
 	DeleteBannerTagsLocks(context.Context, int) error
+	DeleteFeatureSchema(ctx context.Context, featureID int) error
+	DeleteBannerVariant(ctx context.Context, bannerID, variantID int) error
+
+	NotifyBannersChanged(context.Context, []model.BannerKey) error
+
+	StatsStorage
+
+	// WithTx выполняет fn в одной транзакции. Методы хранилища, вызванные с ctx,
+	// переданным в fn, работают внутри нее
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
 
 	Close(context.Context) error
 }
 
+type Cache interface {
+	Get(context.Context, model.BannerKey) (model.Banner, bool, error)
+	Set(context.Context, model.BannerKey, model.Banner) error
+	Delete(context.Context, ...model.BannerKey) error
+	Clear(context.Context) error
+
+	Close() error
+}
+
 type Service struct {
-	repo BannerStorage
+	repo          BannerStorage
+	cache         Cache
+	invalidations *invalidations
+	stats         *StatsWriter
+	renderer      *Renderer
 }
 
-func NewService(repo BannerStorage) *Service {
-	return &Service{repo: repo}
+func NewService(repo BannerStorage, cache Cache, stats *StatsWriter, renderer *Renderer) *Service {
+	return &Service{
+		repo:          repo,
+		cache:         cache,
+		invalidations: newInvalidations(),
+		stats:         stats,
+		renderer:      renderer,
+	}
 }
 
-// Сделать стуктуру, которая является map[pair(feature_id, tag_id)]model.Banner и время, на которое он был актуален
-// Далее я делаю time.Now() и вычисляю разницу и если она меньше 5 минут, то возращаю из map, если больше, иду в базу
-// и кэширую, должна быть таска на очищение неактуальных баннеров
-// можно сделать pkg/casher в котором будет хранится интерфейс
-func (s *Service) GetUserBannerAction(ctx context.Context, p model.GetUserBannerParams) (interface{}, error) {
+// GetUserBannerAction возвращает содержимое баннера для пользователя или nil, если баннер выключен.
+// Если у баннера есть варианты, пользователь получает один из них
+func (s *Service) GetUserBannerAction(ctx context.Context, p model.GetUserBannerParams) (*model.UserBanner, error) {
 	log.Println("running GetUserBannerAction")
 
 	var (
 		banner model.Banner
+		found  bool
 		err    error
 	)
 
-	log.Println("using last revision")
-	banner, err = s.repo.GetUserBanner(ctx, p.TagID, p.FeatureID)
-	if err != nil {
-		return nil, err
+	key := model.BannerKey{TagID: p.TagID, FeatureID: p.FeatureID}
+	if !p.UseLastRevision {
+		banner, found, err = s.cache.Get(ctx, key)
+		if err != nil {
+			log.Printf("failed to get banner from cache: %v\n", err)
+		}
 	}
 
-	if !banner.IsActive && !p.IsAdmin {
+	if !found {
+		if p.UseLastRevision {
+			log.Println("using last revision")
+		} else {
+			log.Println("cache miss")
+		}
+		generation := s.invalidations.current()
+		banner, err = s.repo.GetUserBanner(ctx, p.TagID, p.FeatureID)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.cacheBanner(ctx, key, banner, generation); err != nil {
+			log.Printf("failed to put banner into cache: %v\n", err)
+		}
+	}
+
+	now := time.Now()
+	if !banner.IsActiveAt(now) && !p.IsAdmin {
 		return nil, nil
 	}
-	return banner.Content, nil
+	result := pickVariant(banner, p.UserID)
+	if result.VariantID == 0 {
+		result.Content, result.Language = localize(banner, p.Languages)
+	}
+	result.Content = s.renderer.Render(result.Content, p, now)
+	s.stats.Record(model.BannerEvent{
+		Type:      model.EventImpression,
+		BannerID:  banner.ID,
+		TagID:     p.TagID,
+		VariantID: result.VariantID,
+		Time:      now,
+	})
+	return &result, nil
+}
+
+// WarmUpCache загружает в кэш полный снимок баннеров. Тегов и фич не больше 1000,
+// поэтому все активные пары (tag_id, feature_id) помещаются в память. Пары, инвалидированные
+// после начала чтения снимка, пропускаются: для них снимок мог оказаться устаревшим
+func (s *Service) WarmUpCache(ctx context.Context) error {
+	log.Println("warming up cache")
+
+	generation := s.invalidations.current()
+	banners, err := s.repo.GetFilteredBanners(ctx, model.GetFilteredBannersParams{Limit: -1})
+	if err != nil {
+		return err
+	}
+	cached := 0
+	for _, b := range banners {
+		for _, tag := range b.Tags {
+			if err := s.cacheBanner(ctx, model.BannerKey{TagID: tag, FeatureID: b.FeatureID}, b.Banner, generation); err != nil {
+				return err
+			}
+			cached++
+		}
+	}
+	log.Printf("cache warmed up: %d banners\n", cached)
+	return nil
+}
+
+// RunCacheRefresher периодически обновляет снимок в кэше, пока не будет отменен ctx
+func (s *Service) RunCacheRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.WarmUpCache(ctx); err != nil {
+				log.Printf("failed to refresh cache: %v\n", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func (s *Service) GetFilteredBannersAction(
 	ctx context.Context,
 	p model.GetFilteredBannersParams,
-) ([]model.BannerWithTags, error) {
+) (model.BannersPage, error) {
 	log.Println("running GetFilteredBannersAction")
 
-	var banners []model.BannerWithTags
-	if p.TagID != 0 && p.FeatureID != 0 {
-		result, err := s.repo.GetUserBanner(ctx, p.TagID, p.FeatureID)
-		if err != nil {
-			return nil, err
+	if p.SortBy == "" {
+		p.SortBy = model.SortByUpdatedAt
+	}
+	// запрашиваем на один баннер больше, чтобы понять, есть ли следующая страница
+	paginate := p.UseCursor && p.Limit > 0
+	if paginate {
+		p.Limit++
+	}
+	banners, err := s.repo.GetFilteredBanners(ctx, p)
+	if err != nil {
+		return model.BannersPage{}, err
+	}
+
+	page := model.BannersPage{Items: banners, Offset: p.Offset}
+	if paginate {
+		p.Limit--
+		if len(banners) > p.Limit {
+			page.Items = banners[:p.Limit]
+			last := page.Items[len(page.Items)-1]
+			page.NextCursor = model.NewBannerCursor(last.Banner, p.SortBy, p.SortDesc).Encode()
 		}
-		banners = append(banners, model.BannerWithTags{
-			Banner: result,
-			Tags:   []int{p.TagID},
-		})
-	} else if p.TagID != 0 {
-		result, err := s.repo.GetBannersByTag(ctx, p.TagID)
+	}
+	if p.Limit != -1 {
+		page.Limit = &p.Limit
+	}
+	if p.WithTotal {
+		total, err := s.repo.CountBanners(ctx, p)
 		if err != nil {
-			return nil, err
+			return model.BannersPage{}, err
 		}
-		for _, b := range result {
-			banners = append(banners, model.BannerWithTags{
-				Banner: b,
-				Tags:   []int{p.TagID},
-			})
+		page.Total = &total
+	}
+	return page, nil
+}
+
+func (s *Service) CreateBannerAction(ctx context.Context, p model.BannerParams) (int, error) {
+	log.Println("running CreateBannerAction")
+	// колонки banner хранят время без часового пояса, поэтому пишем его в UTC, как и границы окна показа
+	now := time.Now().UTC()
+	banner := model.Banner{
+		FeatureID:        valueOf(p.FeatureID),
+		Content:          p.Content,
+		LocalizedContent: nonEmpty(valueOf(p.LocalizedContent)),
+		IsActive:         valueOf(p.IsActive),
+		ActiveFrom:       utc(p.ActiveFrom.Time),
+		ActiveUntil:      utc(p.ActiveUntil.Time),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	tags := valueOf(p.TagIDs)
+	keys := bannerKeys(banner.FeatureID, tags)
+
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.validateContent(ctx, banner.FeatureID, banner.Content); err != nil {
+			return err
 		}
-	} else if p.FeatureID != 0 {
-		result, err := s.repo.GetBannersByFeature(ctx, p.FeatureID)
-		if err != nil {
-			return nil, err
+		if err := s.validateLocalizedContent(ctx, banner.FeatureID, banner.LocalizedContent); err != nil {
+			return err
 		}
-		for _, b := range result {
-			tags, err := s.repo.GetTagsByBannerID(ctx, b.ID)
-			if err != nil {
-				return nil, err
+		if err := s.validateVariants(ctx, banner.FeatureID, variantContents(p.Variants)); err != nil {
+			return err
+		}
+		if err := checkVariantIDs(nil, p.Variants); err != nil {
+			return err
+		}
+		if err := checkLocalizedVariants(banner.LocalizedContent, len(valueOf(p.Variants))); err != nil {
+			return err
+		}
+
+		var err error
+		if banner.ID, err = s.repo.CreateBanner(ctx, banner); err != nil {
+			return err
+		}
+		if err := s.createBannerTags(ctx, banner.ID, tags); err != nil {
+			return err
+		}
+		var variants []model.BannerVariant
+		if p.Variants != nil {
+			if variants, err = s.replaceBannerVariants(ctx, banner.ID, *p.Variants); err != nil {
+				return err
 			}
-			banners = append(banners, model.BannerWithTags{
-				Banner: b,
-				Tags:   tags,
-			})
 		}
-	} else {
-		result, err := s.repo.GetAllBanners(ctx)
-		if err != nil {
-			return nil, err
+		if _, err := s.repo.CreateBannerRevision(ctx, newRevision(banner, tags, variants, p.Author)); err != nil {
+			return err
 		}
-		for _, b := range result {
-			tags, err := s.repo.GetTagsByBannerID(ctx, b.ID)
+		return s.repo.NotifyBannersChanged(ctx, keys)
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.InvalidateCache(ctx, keys)
+
+	return banner.ID, nil
+}
+
+func (s *Service) PatchBannerAction(ctx context.Context, id int, p model.BannerParams) error {
+	log.Println("running PatchBannerAction")
+	var keys []model.BannerKey
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		// откат восстанавливает удаленные варианты по идентификаторам, а в запросе они должны быть текущими
+		if p.Variants != nil {
+			existing, err := s.repo.GetBannerVariants(ctx, id)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			if err := checkVariantIDs(existing, p.Variants); err != nil {
+				return err
 			}
-			banners = append(banners, model.BannerWithTags{
-				Banner: b,
-				Tags:   tags,
-			})
 		}
+		var err error
+		keys, err = s.patchBanner(ctx, id, p)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	if len(banners) > p.Limit && p.Limit != -1 {
-		banners = banners[:p.Limit]
+	s.InvalidateCache(ctx, keys)
+	return nil
+}
+
+// patchBanner меняет только переданные поля баннера и возвращает все затронутые пары (tag_id, feature_id).
+// Должен вызываться внутри транзакции
+func (s *Service) patchBanner(ctx context.Context, id int, p model.BannerParams) ([]model.BannerKey, error) {
+	oldBanner, err := s.repo.GetBannerByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	if len(banners) < p.Offset {
-		return []model.BannerWithTags{}, nil
+	oldTags, err := s.repo.GetTagsByBannerID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	return banners[p.Offset:], nil
-}
 
-func (s *Service) CreateBannerAction(ctx context.Context, p model.BannerParams) (int, error) {
-	log.Println("running CreateBannerAction")
-	banner := model.Banner{
-		ID:        rand.Int(),
-		FeatureID: p.FeatureID,
-		Content:   p.Content,
-		IsActive:  p.IsActive,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	banner, tags := oldBanner, oldTags
+	if p.FeatureID != nil {
+		banner.FeatureID = *p.FeatureID
 	}
-	for _, tag := range p.TagIDs {
-		if _, err := s.repo.GetUserBanner(ctx, tag, p.FeatureID); !errors.Is(err, pgx.ErrNoRows) {
-			return 0, ErrAlreadyExists
-		}
+	if p.Content != nil {
+		banner.Content = p.Content
+	}
+	if p.LocalizedContent != nil {
+		banner.LocalizedContent = nonEmpty(*p.LocalizedContent)
+	}
+	if p.IsActive != nil {
+		banner.IsActive = *p.IsActive
+	}
+	if p.TagIDs != nil {
+		tags = *p.TagIDs
 	}
+	if p.ActiveFrom.Set {
+		banner.ActiveFrom = utc(p.ActiveFrom.Time)
+	}
+	if p.ActiveUntil.Set {
+		banner.ActiveUntil = utc(p.ActiveUntil.Time)
+	}
+	banner.UpdatedAt = time.Now().UTC()
 
-	if err := s.repo.CreateBanner(ctx, banner); err != nil {
-		return 0, err
+	featureChanged := banner.FeatureID != oldBanner.FeatureID
+	if p.Content != nil || featureChanged {
+		if err := s.validateContent(ctx, banner.FeatureID, banner.Content); err != nil {
+			return nil, err
+		}
 	}
-	for _, tag := range p.TagIDs {
-		if err := s.repo.CreateTag(ctx, tag); err != nil {
-			return 0, err
+	if p.LocalizedContent != nil || featureChanged {
+		if err := s.validateLocalizedContent(ctx, banner.FeatureID, banner.LocalizedContent); err != nil {
+			return nil, err
 		}
-		if err := s.repo.CreateBannerTagLock(ctx, banner.ID, tag); err != nil {
-			return 0, err
+	}
+	if err := s.validatePatchedVariants(ctx, banner, p.Variants, featureChanged); err != nil {
+		return nil, err
+	}
+	if p.LocalizedContent != nil || p.Variants != nil {
+		variants := len(valueOf(p.Variants))
+		if p.Variants == nil {
+			stored, err := s.repo.GetBannerVariants(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			variants = len(stored)
+		}
+		if err := checkLocalizedVariants(banner.LocalizedContent, variants); err != nil {
+			return nil, err
 		}
 	}
 
-	return banner.ID, nil
+	// связи пересоздаются, только если поменялись теги или фича. Удаляются они до смены фичи,
+	// чтобы каскадное обновление banner_tag не упиралось в уникальность пар, которые все равно будут сняты
+	relink := p.TagIDs != nil || banner.FeatureID != oldBanner.FeatureID
+	if relink {
+		if err := s.repo.DeleteBannerTagsLocks(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.PatchBanner(ctx, banner); err != nil {
+		return nil, err
+	}
+	if relink {
+		if err := s.createBannerTags(ctx, id, tags); err != nil {
+			return nil, err
+		}
+	}
+	var variants []model.BannerVariant
+	if p.Variants != nil {
+		variants, err = s.replaceBannerVariants(ctx, id, *p.Variants)
+	} else {
+		variants, err = s.repo.GetBannerVariants(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.CreateBannerRevision(ctx, newRevision(banner, tags, variants, p.Author)); err != nil {
+		return nil, err
+	}
+
+	// инвалидируем и старые пары, чтобы снятые с баннера теги перестали его получать
+	keys := append(bannerKeys(oldBanner.FeatureID, oldTags), bannerKeys(banner.FeatureID, tags)...)
+	if err := s.repo.NotifyBannersChanged(ctx, keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
 }
 
-func (s *Service) PatchBannerAction(ctx context.Context, id int, p model.BannerParams) error {
-	log.Println("running CreateBannerAction")
-	banner := model.Banner{
-		ID:        id,
-		FeatureID: p.FeatureID,
-		Content:   p.Content,
-		IsActive:  p.IsActive,
-		UpdatedAt: time.Now(),
+func (s *Service) GetBannerVersionsAction(ctx context.Context, id int) ([]model.BannerRevision, error) {
+	log.Println("running GetBannerVersionsAction")
+	if _, err := s.repo.GetBannerByID(ctx, id); err != nil {
+		return nil, err
 	}
-	if err := s.repo.PatchBanner(ctx, banner); err != nil {
+	return s.repo.GetBannerRevisions(ctx, id)
+}
+
+func (s *Service) GetBannerVersionAction(ctx context.Context, id, version int) (model.BannerRevision, error) {
+	log.Println("running GetBannerVersionAction")
+	return s.repo.GetBannerRevision(ctx, id, version)
+}
+
+// RollbackBannerAction восстанавливает содержимое, локали, варианты, фичу и теги баннера из указанной версии.
+// Откат сохраняется как новая версия. Локали и варианты версий, записанных до их появления в истории, не меняются
+func (s *Service) RollbackBannerAction(ctx context.Context, id, version int, author string) error {
+	log.Println("running RollbackBannerAction")
+	var keys []model.BannerKey
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		revision, err := s.repo.GetBannerRevision(ctx, id, version)
+		if err != nil {
+			return err
+		}
+
+		params := model.BannerParams{
+			TagIDs:    &revision.Tags,
+			FeatureID: &revision.FeatureID,
+			Content:   revision.Content,
+			Author:    author,
+		}
+		if revision.LocalizedContent != nil {
+			params.LocalizedContent = &revision.LocalizedContent
+		}
+		if revision.Variants != nil {
+			variants := variantParams(revision.Variants)
+			params.Variants = &variants
+		}
+		keys, err = s.patchBanner(ctx, id, params)
+		return err
+	})
+	if err != nil {
 		return err
 	}
-	if err := s.repo.DeleteBannerTagsLocks(ctx, id); err != nil {
+	s.InvalidateCache(ctx, keys)
+	return nil
+}
+
+func (s *Service) DeleteBannerAction(ctx context.Context, id int) error {
+	log.Println("running DeleteBannerAction")
+	var keys []model.BannerKey
+	err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+		banner, err := s.repo.GetBannerByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		tags, err := s.repo.GetTagsByBannerID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.DeleteBannerTagsLocks(ctx, id); err != nil {
+			return err
+		}
+		if err := s.repo.DeleteBanner(ctx, id); err != nil {
+			return err
+		}
+
+		keys = bannerKeys(banner.FeatureID, tags)
+		return s.repo.NotifyBannersChanged(ctx, keys)
+	})
+	if err != nil {
 		return err
 	}
-	for _, tag := range p.TagIDs {
+	s.InvalidateCache(ctx, keys)
+	return nil
+}
+
+// InvalidateCache удаляет пары из кэша этой реплики. Вызывается после коммита,
+// чтобы параллельное чтение не закэшировало старую версию баннера
+func (s *Service) InvalidateCache(ctx context.Context, keys []model.BannerKey) {
+	s.invalidations.add(keys)
+	if err := s.cache.Delete(ctx, keys...); err != nil {
+		log.Printf("failed to invalidate cache: %v\n", err)
+	}
+}
+
+func (s *Service) createBannerTags(ctx context.Context, bannerID int, tags []int) error {
+	for _, tag := range tags {
 		if err := s.repo.CreateTag(ctx, tag); err != nil {
 			return err
 		}
-		if err := s.repo.CreateBannerTagLock(ctx, banner.ID, tag); err != nil {
+		if err := s.repo.CreateBannerTagLock(ctx, bannerID, tag); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *Service) DeleteBannerAction(ctx context.Context, id int) error {
-	log.Println("running DeleteBannerAction")
-	if err := s.repo.DeleteBannerTagsLocks(ctx, id); err != nil {
-		return err
+func valueOf[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
 	}
+	return v
+}
 
-	if err := s.repo.DeleteBanner(ctx, id); err != nil {
-		return err
+func nonEmpty(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
 	}
-	return nil
+	return m
+}
+
+// utc приводит время к UTC: колонки banner хранят время без часового пояса
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// newRevision записывает пустые локали и варианты как пустые, а не nil: nil означает версию,
+// записанную до того, как их начали сохранять
+func newRevision(b model.Banner, tags []int, variants []model.BannerVariant, author string) model.BannerRevision {
+	localized := b.LocalizedContent
+	if localized == nil {
+		localized = map[string]interface{}{}
+	}
+	if variants == nil {
+		variants = []model.BannerVariant{}
+	}
+	return model.BannerRevision{
+		BannerID:         b.ID,
+		FeatureID:        b.FeatureID,
+		Tags:             tags,
+		Content:          b.Content,
+		LocalizedContent: localized,
+		Variants:         variants,
+		IsActive:         b.IsActive,
+		UpdatedAt:        b.UpdatedAt,
+		Author:           author,
+	}
+}
+
+func bannerKeys(featureID int, tags []int) []model.BannerKey {
+	keys := make([]model.BannerKey, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, model.BannerKey{TagID: tag, FeatureID: featureID})
+	}
+	return keys
 }
 
 func (s *Service) AuthAction(ctx context.Context) (int, error) {
@@ -0,0 +1,901 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+
+	"banner-service/internal/adapter/memory"
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+type fakeStorage struct {
+	mu        sync.Mutex
+	nextID    int
+	banners   map[int]model.Banner
+	tags      map[int][]int
+	revisions map[int][]model.BannerRevision
+	schemas   map[int]model.FeatureSchema
+	variants  map[int][]model.BannerVariant
+	stats     []model.BannerStats
+
+	// afterSnapshot вызывается после чтения GetFilteredBanners, до того как снимок попадет в кэш
+	afterSnapshot func()
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		banners:   make(map[int]model.Banner),
+		tags:      make(map[int][]int),
+		revisions: make(map[int][]model.BannerRevision),
+		schemas:   make(map[int]model.FeatureSchema),
+		variants:  make(map[int][]model.BannerVariant),
+	}
+}
+
+func (f *fakeStorage) GetUserBanner(_ context.Context, tagID int, featureID int) (model.Banner, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, b := range f.banners {
+		if b.FeatureID != featureID {
+			continue
+		}
+		for _, tag := range f.tags[id] {
+			if tag == tagID {
+				b.Variants = f.variants[id]
+				return b, nil
+			}
+		}
+	}
+	return model.Banner{}, pgx.ErrNoRows
+}
+
+func (f *fakeStorage) GetBannerByID(_ context.Context, id int) (model.Banner, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, ok := f.banners[id]
+	if !ok {
+		return model.Banner{}, pgx.ErrNoRows
+	}
+	return b, nil
+}
+
+func (f *fakeStorage) GetBannerByIDForUpdate(ctx context.Context, id int) (model.Banner, error) {
+	return f.GetBannerByID(ctx, id)
+}
+
+func (f *fakeStorage) GetFilteredBanners(
+	_ context.Context,
+	p model.GetFilteredBannersParams,
+) ([]model.BannerWithTags, error) {
+	f.mu.Lock()
+	banners := make([]model.BannerWithTags, 0, len(f.banners))
+	for id, b := range f.banners {
+		if len(p.FeatureIDs) > 0 && !slices.Contains(p.FeatureIDs, b.FeatureID) {
+			continue
+		}
+		if p.Cursor != nil && id <= p.Cursor.ID {
+			continue
+		}
+		banners = append(banners, model.BannerWithTags{Banner: b, Tags: append([]int(nil), f.tags[id]...)})
+	}
+	hook := f.afterSnapshot
+	f.mu.Unlock()
+
+	// фейк сортирует только по id
+	slices.SortFunc(banners, func(a, b model.BannerWithTags) int { return a.ID - b.ID })
+	banners = banners[min(p.Offset, len(banners)):]
+	if p.Limit >= 0 && p.Limit < len(banners) {
+		banners = banners[:p.Limit]
+	}
+
+	if hook != nil {
+		hook()
+	}
+	return banners, nil
+}
+
+func (f *fakeStorage) CountBanners(ctx context.Context, p model.GetFilteredBannersParams) (int, error) {
+	p.Limit, p.Offset, p.Cursor = -1, 0, nil
+	banners, err := f.GetFilteredBanners(ctx, p)
+	return len(banners), err
+}
+
+func (f *fakeStorage) GetTagsByBannerID(_ context.Context, id int) ([]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]int(nil), f.tags[id]...), nil
+}
+
+func (f *fakeStorage) GetAllTags(context.Context) ([]int, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) GetBannerRevisions(_ context.Context, id int) ([]model.BannerRevision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]model.BannerRevision(nil), f.revisions[id]...), nil
+}
+
+func (f *fakeStorage) GetBannerRevision(_ context.Context, id, version int) (model.BannerRevision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range f.revisions[id] {
+		if r.Version == version {
+			return r, nil
+		}
+	}
+	return model.BannerRevision{}, pgx.ErrNoRows
+}
+
+func (f *fakeStorage) GetFeatureSchema(_ context.Context, featureID int) (model.FeatureSchema, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs, ok := f.schemas[featureID]
+	if !ok {
+		return model.FeatureSchema{}, pgx.ErrNoRows
+	}
+	return fs, nil
+}
+
+func (f *fakeStorage) SetFeatureSchema(_ context.Context, fs model.FeatureSchema) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.schemas[fs.FeatureID] = fs
+	return nil
+}
+
+func (f *fakeStorage) DeleteFeatureSchema(_ context.Context, featureID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.schemas[featureID]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(f.schemas, featureID)
+	return nil
+}
+
+func (f *fakeStorage) GetBannerVariants(_ context.Context, bannerID int) ([]model.BannerVariant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]model.BannerVariant(nil), f.variants[bannerID]...), nil
+}
+
+func (f *fakeStorage) CreateBannerVariant(_ context.Context, bannerID int, v model.BannerVariant) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if v.ID == 0 {
+		f.nextID++
+		v.ID = f.nextID
+	}
+	f.variants[bannerID] = append(f.variants[bannerID], v)
+	slices.SortFunc(f.variants[bannerID], func(a, b model.BannerVariant) int { return a.ID - b.ID })
+	return v.ID, nil
+}
+
+func (f *fakeStorage) UpdateBannerVariant(_ context.Context, bannerID int, v model.BannerVariant) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, stored := range f.variants[bannerID] {
+		if stored.ID == v.ID {
+			f.variants[bannerID][i] = v
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
+
+func (f *fakeStorage) DeleteBannerVariant(_ context.Context, bannerID, variantID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.variants[bannerID] = slices.DeleteFunc(f.variants[bannerID], func(v model.BannerVariant) bool {
+		return v.ID == variantID
+	})
+	return nil
+}
+
+func (f *fakeStorage) AddBannerStats(_ context.Context, stats []model.BannerStats) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats = append(f.stats, stats...)
+	return nil
+}
+
+func (f *fakeStorage) GetBannerStats(_ context.Context, bannerID int) ([]model.BannerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var stats []model.BannerStats
+	for _, st := range f.stats {
+		if st.BannerID == bannerID {
+			stats = append(stats, st)
+		}
+	}
+	return stats, nil
+}
+
+func (f *fakeStorage) CreateBanner(_ context.Context, b model.Banner) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	b.ID = f.nextID
+	f.banners[b.ID] = b
+	return b.ID, nil
+}
+
+func (f *fakeStorage) CreateTag(context.Context, int) error {
+	return nil
+}
+
+func (f *fakeStorage) CreateBannerTagLock(_ context.Context, bannerID, tagID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	featureID := f.banners[bannerID].FeatureID
+	for id, tags := range f.tags {
+		if id == bannerID || f.banners[id].FeatureID != featureID {
+			continue
+		}
+		for _, tag := range tags {
+			if tag == tagID {
+				return &ErrAlreadyExists{BannerID: id, TagID: tagID, FeatureID: featureID}
+			}
+		}
+	}
+	f.tags[bannerID] = append(f.tags[bannerID], tagID)
+	return nil
+}
+
+func (f *fakeStorage) CreateBannerRevision(_ context.Context, r model.BannerRevision) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r.Version = len(f.revisions[r.BannerID]) + 1
+	f.revisions[r.BannerID] = append(f.revisions[r.BannerID], r)
+	return r.Version, nil
+}
+
+func (f *fakeStorage) PatchBanner(_ context.Context, b model.Banner) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old, ok := f.banners[b.ID]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	b.CreatedAt = old.CreatedAt
+	f.banners[b.ID] = b
+	return nil
+}
+
+func (f *fakeStorage) DeleteBanner(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.banners[id]; !ok {
+		return pgx.ErrNoRows
+	}
+	delete(f.banners, id)
+	delete(f.revisions, id)
+	return nil
+}
+
+func (f *fakeStorage) DeleteBannerTagsLocks(_ context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.tags, id)
+	return nil
+}
+
+func (f *fakeStorage) NotifyBannersChanged(context.Context, []model.BannerKey) error {
+	return nil
+}
+
+func (f *fakeStorage) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (f *fakeStorage) Close(context.Context) error {
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newTestService(t *testing.T) *Service {
+	cache := memory.NewCache(config.CacheConfig{TTL: time.Hour, CleanupInterval: time.Hour})
+	t.Cleanup(func() { _ = cache.Close() })
+	repo := newFakeStorage()
+	stats := NewStatsWriter(repo, 10000, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	go stats.Run(ctx, time.Hour)
+	t.Cleanup(func() {
+		cancel()
+		<-stats.Done()
+	})
+	return NewService(repo, cache, stats, NewRenderer(nil))
+}
+
+func TestPatchInvalidatesCache(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1, 2}),
+		FeatureID: ptr(10),
+		Content:   "old",
+		IsActive:  ptr(true),
+	})
+	require.NoError(t, err)
+
+	read := model.GetUserBannerParams{TagID: 1, FeatureID: 10}
+	content, err := s.GetUserBannerAction(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, "old", content.Content)
+
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "new",
+		IsActive:  ptr(true),
+	})
+	require.NoError(t, err)
+
+	content, err = s.GetUserBannerAction(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, "new", content.Content)
+
+	_, err = s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: 2, FeatureID: 10})
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestDeleteInvalidatesCache(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "content",
+		IsActive:  ptr(true),
+	})
+	require.NoError(t, err)
+
+	read := model.GetUserBannerParams{TagID: 1, FeatureID: 10}
+	_, err = s.GetUserBannerAction(ctx, read)
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteBannerAction(ctx, id))
+
+	_, err = s.GetUserBannerAction(ctx, read)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestWarmUpSkipsKeysInvalidatedDuringSnapshot(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "old", IsActive: ptr(true)})
+	require.NoError(t, err)
+
+	// изменение баннера коммитится между чтением снимка и записью его в кэш
+	repo := s.repo.(*fakeStorage)
+	repo.afterSnapshot = func() {
+		repo.afterSnapshot = nil
+		require.NoError(t, s.PatchBannerAction(ctx, id, model.BannerParams{Content: "new"}))
+	}
+	require.NoError(t, s.WarmUpCache(ctx))
+
+	content, err := s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: 1, FeatureID: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "new", content.Content)
+}
+
+func TestResyncCacheDropsMissedChanges(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1, 2}), FeatureID: ptr(10), Content: "content", IsActive: ptr(true)})
+	require.NoError(t, err)
+	require.NoError(t, s.WarmUpCache(ctx))
+
+	// тег 2 снят с баннера другой репликой, уведомление об этом потерялось
+	repo := s.repo.(*fakeStorage)
+	repo.mu.Lock()
+	repo.tags[id] = []int{1}
+	repo.mu.Unlock()
+
+	require.NoError(t, s.ResyncCache(ctx))
+
+	_, found, err := s.cache.Get(ctx, model.BannerKey{TagID: 2, FeatureID: 10})
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = s.cache.Get(ctx, model.BannerKey{TagID: 1, FeatureID: 10})
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestCacheRefresherLoadsSnapshot(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "content", IsActive: ptr(true)})
+	require.NoError(t, err)
+
+	snapshots := make(chan struct{}, 1)
+	repo := s.repo.(*fakeStorage)
+	repo.afterSnapshot = func() {
+		select {
+		case snapshots <- struct{}{}:
+		default:
+		}
+	}
+
+	refreshCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.RunCacheRefresher(refreshCtx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-snapshots:
+	case <-time.After(time.Second):
+		t.Fatal("cache was not refreshed")
+	}
+	require.Eventually(t, func() bool {
+		_, found, err := s.cache.Get(ctx, model.BannerKey{TagID: 1, FeatureID: 10})
+		return err == nil && found
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refresher did not stop after cancel")
+	}
+}
+
+func TestRollbackRestoresRevision(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "v1", IsActive: ptr(true)})
+	require.NoError(t, err)
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{TagIDs: ptr([]int{2}), FeatureID: ptr(10), Content: "v2", IsActive: ptr(true)})
+	require.NoError(t, err)
+
+	require.NoError(t, s.RollbackBannerAction(ctx, id, 1, "admin"))
+
+	content, err := s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: 1, FeatureID: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", content.Content)
+
+	versions, err := s.GetBannerVersionsAction(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "admin", versions[2].Author)
+}
+
+func TestRollbackRestoresLocalesAndVariants(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:           ptr([]int{1}),
+		FeatureID:        ptr(10),
+		Content:          "v1",
+		LocalizedContent: ptr(map[string]interface{}{"en": "v1 en"}),
+		IsActive:         ptr(true),
+	})
+	require.NoError(t, err)
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{
+		Content:          "v2",
+		LocalizedContent: ptr(map[string]interface{}{}),
+		Variants:         ptr([]model.BannerVariantParams{{Content: "v2 a", Weight: 1}}),
+	})
+	require.NoError(t, err)
+
+	versions, err := s.GetBannerVersionsAction(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, map[string]interface{}{"en": "v1 en"}, versions[0].LocalizedContent)
+	assert.Empty(t, versions[0].Variants)
+	assert.Empty(t, versions[1].LocalizedContent)
+	require.Len(t, versions[1].Variants, 1)
+	assert.Equal(t, "v2 a", versions[1].Variants[0].Content)
+
+	require.NoError(t, s.RollbackBannerAction(ctx, id, 1, "admin"))
+
+	repo := s.repo.(*fakeStorage)
+	banner, err := repo.GetBannerByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", banner.Content)
+	assert.Equal(t, map[string]interface{}{"en": "v1 en"}, banner.LocalizedContent)
+	variants, err := repo.GetBannerVariants(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, variants)
+
+	// версия, записанная до сохранения локалей и вариантов, их не трогает
+	repo.mu.Lock()
+	repo.revisions[id][1].LocalizedContent = nil
+	repo.revisions[id][1].Variants = nil
+	repo.mu.Unlock()
+	require.NoError(t, s.RollbackBannerAction(ctx, id, 2, "admin"))
+
+	banner, err = repo.GetBannerByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", banner.Content)
+	assert.Equal(t, map[string]interface{}{"en": "v1 en"}, banner.LocalizedContent)
+	variants, err = repo.GetBannerVariants(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, variants)
+}
+
+func TestLocalizedContentExcludesVariants(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:           ptr([]int{1}),
+		FeatureID:        ptr(10),
+		Content:          "v1",
+		LocalizedContent: ptr(map[string]interface{}{"en": "v1 en"}),
+		Variants:         ptr([]model.BannerVariantParams{{Content: "v1 a", Weight: 1}}),
+		IsActive:         ptr(true),
+	})
+	assert.ErrorIs(t, err, ErrLocalizedVariants)
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:           ptr([]int{1}),
+		FeatureID:        ptr(10),
+		Content:          "v1",
+		LocalizedContent: ptr(map[string]interface{}{"en": "v1 en"}),
+		IsActive:         ptr(true),
+	})
+	require.NoError(t, err)
+	// варианты нельзя добавить к баннеру с локалями, не сняв их
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{
+		Variants: ptr([]model.BannerVariantParams{{Content: "v2 a", Weight: 1}}),
+	})
+	assert.ErrorIs(t, err, ErrLocalizedVariants)
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{
+		LocalizedContent: ptr(map[string]interface{}{}),
+		Variants:         ptr([]model.BannerVariantParams{{Content: "v2 a", Weight: 1}}),
+	})
+	require.NoError(t, err)
+	// и наоборот: локали нельзя добавить к баннеру с вариантами
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{
+		LocalizedContent: ptr(map[string]interface{}{"en": "v3 en"}),
+	})
+	assert.ErrorIs(t, err, ErrLocalizedVariants)
+}
+
+func TestVariantIDsStayStable(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "default",
+		Variants:  ptr([]model.BannerVariantParams{{Content: "a", Weight: 1}, {Content: "b", Weight: 1}}),
+	})
+	require.NoError(t, err)
+	v1, err := s.repo.GetBannerVariants(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, v1, 2)
+
+	// вариант a меняется на месте, b удаляется, c добавляется
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{Variants: ptr([]model.BannerVariantParams{
+		{ID: v1[0].ID, Content: "a2", Weight: 2},
+		{Content: "c", Weight: 1},
+	})})
+	require.NoError(t, err)
+	v2, err := s.repo.GetBannerVariants(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, v2, 2)
+	assert.Equal(t, model.BannerVariant{ID: v1[0].ID, Content: "a2", Weight: 2}, v2[0])
+	assert.NotContains(t, []int{v1[0].ID, v1[1].ID}, v2[1].ID)
+
+	// чужой или удаленный идентификатор в запросе не принимается
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{Variants: ptr([]model.BannerVariantParams{
+		{ID: v1[1].ID, Content: "b", Weight: 1},
+	})})
+	assert.ErrorIs(t, err, ErrInvalidVariant)
+
+	// откат возвращает варианты с прежними идентификаторами
+	require.NoError(t, s.RollbackBannerAction(ctx, id, 1, "admin"))
+	restored, err := s.repo.GetBannerVariants(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, v1, restored)
+}
+
+func TestCreateDuplicateReturnsConflictingBanner(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "first"})
+	require.NoError(t, err)
+
+	_, err = s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{2, 1}), FeatureID: ptr(10), Content: "second"})
+	var alreadyExists *ErrAlreadyExists
+	require.ErrorAs(t, err, &alreadyExists)
+	assert.Equal(t, id, alreadyExists.BannerID)
+	assert.Equal(t, 1, alreadyExists.TagID)
+}
+
+func TestFilteredBannersPaginatedByCursor(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	var ids []int
+	for tag := 1; tag <= 3; tag++ {
+		id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{tag}), FeatureID: ptr(10), Content: "content"})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	params := model.GetFilteredBannersParams{SortBy: model.SortByID, Limit: 2, UseCursor: true, WithTotal: true}
+	page, err := s.GetFilteredBannersAction(ctx, params)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, ids[:2], []int{page.Items[0].ID, page.Items[1].ID})
+	require.NotNil(t, page.Limit)
+	assert.Equal(t, 2, *page.Limit)
+	require.NotNil(t, page.Total)
+	assert.Equal(t, 3, *page.Total)
+	require.NotEmpty(t, page.NextCursor)
+
+	cursor, err := model.DecodeBannerCursor(page.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], cursor.ID)
+	assert.Equal(t, model.SortByID, cursor.SortBy)
+
+	params.Cursor = &cursor
+	page, err = s.GetFilteredBannersAction(ctx, params)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, ids[2], page.Items[0].ID)
+	assert.Empty(t, page.NextCursor)
+
+	// заполненная целиком, но последняя страница курсор не выдает
+	params.Limit, params.Cursor = 3, nil
+	page, err = s.GetFilteredBannersAction(ctx, params)
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 3)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestPatchKeepsOmittedFields(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1, 2}),
+		FeatureID: ptr(10),
+		Content:   "old",
+		IsActive:  ptr(true),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.PatchBannerAction(ctx, id, model.BannerParams{Content: "new"}))
+
+	for _, tag := range []int{1, 2} {
+		content, err := s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: tag, FeatureID: 10})
+		require.NoError(t, err)
+		assert.Equal(t, "new", content.Content)
+	}
+}
+
+func TestBannerTimestampsStoredInUTC(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "v1"})
+	require.NoError(t, err)
+	require.NoError(t, s.PatchBannerAction(ctx, id, model.BannerParams{Content: "v2"}))
+
+	banner, err := s.repo.GetBannerByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, banner.CreatedAt.Location())
+	assert.Equal(t, time.UTC, banner.UpdatedAt.Location())
+}
+
+func TestContentValidatedAgainstFeatureSchema(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["title"],
+		"properties": {"title": {"type": "string"}, "url": {"type": "string", "format": "uri"}}
+	}`)
+	require.NoError(t, s.SetFeatureSchemaAction(ctx, 10, schema))
+
+	_, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   map[string]interface{}{"title": 1},
+	})
+	var invalid *ErrInvalidContent
+	require.ErrorAs(t, err, &invalid)
+	require.Len(t, invalid.Violations, 1)
+	assert.Equal(t, "/title", invalid.Violations[0].Path)
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   map[string]interface{}{"title": "ok"},
+	})
+	require.NoError(t, err)
+
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{Content: map[string]interface{}{"text": "no title"}})
+	require.ErrorAs(t, err, &invalid)
+
+	// без схемы у фичи содержимое не проверяется
+	err = s.PatchBannerAction(ctx, id, model.BannerParams{FeatureID: ptr(20), Content: "anything"})
+	require.NoError(t, err)
+}
+
+func TestSetFeatureSchemaRejectsInvalidSchema(t *testing.T) {
+	s := newTestService(t)
+
+	err := s.SetFeatureSchemaAction(context.Background(), 10, json.RawMessage(`{"type": 1}`))
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+}
+
+func TestSetFeatureSchemaRejectsExternalRefs(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	for _, ref := range []string{"file:///etc/hostname", "/etc/hostname", "https://example.com/schema.json"} {
+		err := s.SetFeatureSchemaAction(ctx, 10, json.RawMessage(fmt.Sprintf(`{"$ref": %q}`, ref)))
+		assert.ErrorIs(t, err, ErrInvalidSchema, ref)
+		assert.ErrorContains(t, err, "is not allowed", ref)
+	}
+
+	// ссылки внутри самой схемы и на стандартные метасхемы по-прежнему работают
+	schema := json.RawMessage(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "$defs": {"title": {"type": "string"}}, "properties": {"title": {"$ref": "#/$defs/title"}}}`)
+	require.NoError(t, s.SetFeatureSchemaAction(ctx, 10, schema))
+}
+
+func TestScheduledBannerShownOnlyInsideWindow(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	from := time.Now().Add(time.Hour)
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:     ptr([]int{1}),
+		FeatureID:  ptr(10),
+		Content:    "scheduled",
+		IsActive:   ptr(true),
+		ActiveFrom: model.NullableTime{Set: true, Time: &from},
+	})
+	require.NoError(t, err)
+
+	read := model.GetUserBannerParams{TagID: 1, FeatureID: 10}
+	content, err := s.GetUserBannerAction(ctx, read)
+	require.NoError(t, err)
+	assert.Nil(t, content)
+
+	// явный null снимает границу окна
+	require.NoError(t, s.PatchBannerAction(ctx, id, model.BannerParams{ActiveFrom: model.NullableTime{Set: true}}))
+
+	content, err = s.GetUserBannerAction(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, "scheduled", content.Content)
+}
+
+func TestUserGetsStableWeightedVariant(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "default",
+		IsActive:  ptr(true),
+		Variants: &[]model.BannerVariantParams{
+			{Content: "a", Weight: 3},
+			{Content: "b", Weight: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	counts := make(map[interface{}]int)
+	for i := 0; i < 1000; i++ {
+		read := model.GetUserBannerParams{TagID: 1, FeatureID: 10, UserID: fmt.Sprintf("user-%d", i)}
+		first, err := s.GetUserBannerAction(ctx, read)
+		require.NoError(t, err)
+		second, err := s.GetUserBannerAction(ctx, read)
+		require.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.NotZero(t, first.VariantID)
+		counts[first.Content]++
+	}
+
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 750, counts["a"], 75)
+}
+
+func TestBannerWithoutVariantsReturnsContent(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	id, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "default",
+		IsActive:  ptr(true),
+		Variants:  &[]model.BannerVariantParams{{Content: "a", Weight: 1}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.PatchBannerAction(ctx, id, model.BannerParams{Variants: &[]model.BannerVariantParams{}}))
+
+	got, err := s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: 1, FeatureID: 10, UserID: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, model.UserBanner{Content: "default"}, *got)
+}
+
+func TestUserBannerLocalizedByLanguage(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(10),
+		Content:   "default",
+		LocalizedContent: &map[string]interface{}{
+			"en":    "english",
+			"pt-BR": "brazilian",
+		},
+		IsActive: ptr(true),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		langs    []language.Tag
+		content  string
+		language string
+	}{
+		{langs: nil, content: "default"},
+		{langs: []language.Tag{language.MustParse("en-GB")}, content: "english", language: "en"},
+		{langs: []language.Tag{language.MustParse("pt")}, content: "brazilian", language: "pt-BR"},
+		{langs: []language.Tag{language.Japanese, language.English}, content: "english", language: "en"},
+		{langs: []language.Tag{language.Japanese}, content: "default"},
+	}
+	for _, tt := range tests {
+		got, err := s.GetUserBannerAction(ctx, model.GetUserBannerParams{TagID: 1, FeatureID: 10, Languages: tt.langs})
+		require.NoError(t, err)
+		assert.Equal(t, tt.content, got.Content, tt.langs)
+		assert.Equal(t, tt.language, got.Language, tt.langs)
+	}
+}
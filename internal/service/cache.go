@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"banner-service/internal/model"
+)
+
+// invalidations запоминает, в каком поколении последний раз инвалидировалась каждая пара.
+// Баннер, прочитанный из хранилища до инвалидации, не должен попасть в кэш после нее.
+// Пар не больше, чем тегов, умноженных на фичи, поэтому записи не удаляются
+type invalidations struct {
+	mu         sync.Mutex
+	generation uint64
+	keys       map[model.BannerKey]uint64
+	// all - поколение, в котором инвалидировался весь кэш
+	all uint64
+}
+
+func newInvalidations() *invalidations {
+	return &invalidations{keys: make(map[model.BannerKey]uint64)}
+}
+
+// current возвращает поколение, которое нужно запомнить перед чтением из хранилища
+func (i *invalidations) current() uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.generation
+}
+
+func (i *invalidations) add(keys []model.BannerKey) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.generation++
+	for _, key := range keys {
+		i.keys[key] = i.generation
+	}
+}
+
+func (i *invalidations) addAll() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.generation++
+	i.all = i.generation
+}
+
+// since сообщает, инвалидировалась ли пара после поколения generation
+func (i *invalidations) since(key model.BannerKey, generation uint64) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return max(i.keys[key], i.all) > generation
+}
+
+// cacheBanner кладет в кэш баннер, прочитанный из хранилища начиная с поколения generation.
+// Если пару инвалидировали после начала чтения, баннер мог устареть и в кэш не попадает.
+// Повторная проверка после Set закрывает гонку с инвалидацией, пришедшей во время записи
+func (s *Service) cacheBanner(ctx context.Context, key model.BannerKey, banner model.Banner, generation uint64) error {
+	if s.invalidations.since(key, generation) {
+		return nil
+	}
+	if err := s.cache.Set(ctx, key, banner); err != nil {
+		return err
+	}
+	if s.invalidations.since(key, generation) {
+		return s.cache.Delete(ctx, key)
+	}
+	return nil
+}
+
+// ResyncCache сбрасывает кэш и заново загружает снимок баннеров. Вызывается, когда инвалидации
+// могли быть пропущены, например после переподключения к каналу изменений
+func (s *Service) ResyncCache(ctx context.Context) error {
+	log.Println("resyncing cache")
+
+	s.invalidations.addAll()
+	if err := s.cache.Clear(ctx); err != nil {
+		return err
+	}
+	return s.WarmUpCache(ctx)
+}
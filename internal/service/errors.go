@@ -1,7 +1,54 @@
 package service
 
-import "errors"
-
-var (
-	ErrAlreadyExists = errors.New("banner with tag_id and feature_id already exists")
+import (
+	"errors"
+	"fmt"
+	"strings"
 )
+
+// ErrAlreadyExists возвращается, когда пара (tag_id, feature_id) уже занята другим баннером
+type ErrAlreadyExists struct {
+	BannerID  int
+	TagID     int
+	FeatureID int
+}
+
+func (e *ErrAlreadyExists) Error() string {
+	if e.BannerID == 0 {
+		return "banner with tag_id and feature_id already exists"
+	}
+	return fmt.Sprintf("banner with tag_id %d and feature_id %d already exists: banner_id %d",
+		e.TagID, e.FeatureID, e.BannerID)
+}
+
+// ErrInvalidSchema возвращается, если JSON Schema фичи не удается скомпилировать
+var ErrInvalidSchema = errors.New("invalid json schema")
+
+// ErrInvalidVariant возвращается, когда клик передан с вариантом, которого нет у баннера
+var ErrInvalidVariant = errors.New("invalid banner variant")
+
+// ErrLocalizedVariants возвращается, когда у баннера одновременно заданы локали и варианты:
+// варианты отдаются без локализации, и локализованное содержимое никогда бы не показывалось
+var ErrLocalizedVariants = errors.New("localized_content can not be combined with variants")
+
+// ContentViolation - нарушение схемы в конкретном месте содержимого. Path - JSON Pointer внутри content
+type ContentViolation struct {
+	Path    string
+	Message string
+}
+
+// ErrInvalidContent возвращается, когда содержимое баннера не соответствует схеме его фичи.
+// Field - поле запроса с невалидным содержимым: content или variants/<i>/content
+type ErrInvalidContent struct {
+	FeatureID  int
+	Field      string
+	Violations []ContentViolation
+}
+
+func (e *ErrInvalidContent) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("%q: %s", v.Path, v.Message))
+	}
+	return fmt.Sprintf("content does not match schema of feature %d: %s", e.FeatureID, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"golang.org/x/text/language"
+
+	"banner-service/internal/model"
+)
+
+// localize выбирает содержимое баннера на самом подходящем из языков пользователя.
+// Если ни одна локаль не подходит, возвращается содержимое по умолчанию и пустой язык
+func localize(b model.Banner, prefs []language.Tag) (interface{}, string) {
+	if len(b.LocalizedContent) == 0 || len(prefs) == 0 {
+		return b.Content, ""
+	}
+
+	locales := make([]string, 0, len(b.LocalizedContent))
+	for locale := range b.LocalizedContent {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	// первый тег матчера - запасной вариант, он означает содержимое по умолчанию
+	tags := []language.Tag{language.Und}
+	keys := []string{""}
+	for _, locale := range locales {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+		keys = append(keys, locale)
+	}
+
+	_, index, confidence := language.NewMatcher(tags).Match(prefs...)
+	if index == 0 || confidence == language.No {
+		return b.Content, ""
+	}
+	return b.LocalizedContent[keys[index]], keys[index]
+}
+
+// checkLocalizedVariants запрещает баннеру иметь и локали, и варианты
+func checkLocalizedVariants(localized map[string]interface{}, variants int) error {
+	if len(localized) > 0 && variants > 0 {
+		return ErrLocalizedVariants
+	}
+	return nil
+}
+
+// validateLocalizedContent проверяет содержимое каждой локали по схеме фичи
+func (s *Service) validateLocalizedContent(ctx context.Context, featureID int, localized map[string]interface{}) error {
+	locales := make([]string, 0, len(localized))
+	for locale := range localized {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	for _, locale := range locales {
+		err := s.validateContent(ctx, featureID, localized[locale])
+		var invalid *ErrInvalidContent
+		if errors.As(err, &invalid) {
+			invalid.Field = "localized_content/" + locale
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
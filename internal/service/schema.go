@@ -0,0 +1,103 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"banner-service/internal/model"
+)
+
+// schemaURL - условный адрес, под которым схема фичи регистрируется в компиляторе. Адрес абсолютный
+// и не file://, чтобы относительные $ref не указывали на файлы сервера
+const schemaURL = "https://banner-service.invalid/feature_schema.json"
+
+func (s *Service) GetFeatureSchemaAction(ctx context.Context, featureID int) (model.FeatureSchema, error) {
+	log.Println("running GetFeatureSchemaAction")
+	return s.repo.GetFeatureSchema(ctx, featureID)
+}
+
+// SetFeatureSchemaAction сохраняет схему фичи. Уже существующие баннеры не перепроверяются,
+// схема применяется к следующим созданиям и изменениям
+func (s *Service) SetFeatureSchemaAction(ctx context.Context, featureID int, schema json.RawMessage) error {
+	log.Println("running SetFeatureSchemaAction")
+	if _, err := compileSchema(schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return s.repo.SetFeatureSchema(ctx, model.FeatureSchema{
+		FeatureID: featureID,
+		Schema:    schema,
+		UpdatedAt: time.Now().UTC(),
+	})
+}
+
+func (s *Service) DeleteFeatureSchemaAction(ctx context.Context, featureID int) error {
+	log.Println("running DeleteFeatureSchemaAction")
+	return s.repo.DeleteFeatureSchema(ctx, featureID)
+}
+
+// validateContent проверяет содержимое по схеме фичи. Если схема не задана, подходит любое содержимое
+func (s *Service) validateContent(ctx context.Context, featureID int, content interface{}) error {
+	fs, err := s.repo.GetFeatureSchema(ctx, featureID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	schema, err := compileSchema(fs.Schema)
+	if err != nil {
+		return fmt.Errorf("compile schema of feature %d: %w", featureID, err)
+	}
+
+	// валидатору нужны значения в том виде, в котором их дает encoding/json
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	err = schema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return &ErrInvalidContent{FeatureID: featureID, Field: "content", Violations: contentViolations(validationErr)}
+	}
+	return err
+}
+
+func compileSchema(raw json.RawMessage) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	// схема присылается администратором, внешние документы по $ref не загружаются
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("loading external schema %q is not allowed", s)
+	}
+	if err := c.AddResource(schemaURL, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return c.Compile(schemaURL)
+}
+
+// contentViolations разворачивает дерево ошибок валидатора в список конечных причин
+func contentViolations(err *jsonschema.ValidationError) []ContentViolation {
+	if len(err.Causes) == 0 {
+		return []ContentViolation{{Path: err.InstanceLocation, Message: err.Message}}
+	}
+	var violations []ContentViolation
+	for _, cause := range err.Causes {
+		violations = append(violations, contentViolations(cause)...)
+	}
+	return violations
+}
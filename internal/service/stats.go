@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"banner-service/internal/model"
+)
+
+// flushTimeout ограничивает последнюю запись статистики при остановке сервиса
+const flushTimeout = 5 * time.Second
+
+type StatsStorage interface {
+	AddBannerStats(context.Context, []model.BannerStats) error
+}
+
+type statsKey struct {
+	bannerID  int
+	day       time.Time
+	tagID     int
+	variantID int
+}
+
+// StatsWriter копит показы и клики в буфере и пишет их в хранилище агрегированными пачками.
+// Record не блокирует запрос: при переполненном буфере событие отбрасывается
+type StatsWriter struct {
+	repo      StatsStorage
+	events    chan model.BannerEvent
+	batchSize int
+	done      chan struct{}
+	// dropped считает события, отброшенные из-за переполненного буфера, с последнего отчета в Run
+	dropped atomic.Int64
+}
+
+func NewStatsWriter(repo StatsStorage, bufferSize, batchSize int) *StatsWriter {
+	return &StatsWriter{
+		repo:      repo,
+		events:    make(chan model.BannerEvent, bufferSize),
+		batchSize: batchSize,
+		done:      make(chan struct{}),
+	}
+}
+
+func (w *StatsWriter) Record(e model.BannerEvent) {
+	select {
+	case w.events <- e:
+	default:
+		// буфер переполнен под нагрузкой: логирование здесь замедлило бы запрос, о потерях сообщает Run
+		w.dropped.Add(1)
+	}
+}
+
+// Run пишет накопленную статистику раз в interval или по заполнении пачки. После отмены ctx
+// дописывает оставшиеся в буфере события и закрывает Done
+func (w *StatsWriter) Run(ctx context.Context, interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make(map[statsKey]*model.BannerStats)
+	for {
+		select {
+		case e := <-w.events:
+			w.add(batch, e)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(ctx, batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(ctx, batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-w.events:
+					w.add(batch, e)
+				default:
+					flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+					w.flush(flushCtx, batch)
+					cancel()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Done закрывается, когда Run записал последнюю пачку
+func (w *StatsWriter) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *StatsWriter) add(batch map[statsKey]*model.BannerStats, e model.BannerEvent) {
+	t := e.Time.UTC()
+	key := statsKey{
+		bannerID:  e.BannerID,
+		day:       time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC),
+		tagID:     e.TagID,
+		variantID: e.VariantID,
+	}
+	st, ok := batch[key]
+	if !ok {
+		st = &model.BannerStats{BannerID: key.bannerID, Day: key.day, TagID: key.tagID, VariantID: key.variantID}
+		batch[key] = st
+	}
+	switch e.Type {
+	case model.EventImpression:
+		st.Impressions++
+	case model.EventClick:
+		st.Clicks++
+	}
+}
+
+// flush записывает пачку и возвращает пустую. При ошибке записи пачка теряется:
+// статистика не стоит того, чтобы копить события без ограничения
+func (w *StatsWriter) flush(ctx context.Context, batch map[statsKey]*model.BannerStats) map[statsKey]*model.BannerStats {
+	if dropped := w.dropped.Swap(0); dropped > 0 {
+		log.Printf("stats buffer is full, %d events dropped\n", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	stats := make([]model.BannerStats, 0, len(batch))
+	for _, st := range batch {
+		stats = append(stats, *st)
+	}
+	if err := w.repo.AddBannerStats(ctx, stats); err != nil {
+		log.Printf("failed to write banner stats: %v\n", err)
+	}
+	return make(map[statsKey]*model.BannerStats)
+}
+
+// ClickBannerAction учитывает клик пользователя с тегом tagID по варианту variantID баннера.
+// Баннер должен быть привязан к тегу пользователя, а вариант - принадлежать баннеру:
+// variantID равен 0 только у баннеров без вариантов
+func (s *Service) ClickBannerAction(ctx context.Context, bannerID, tagID, variantID int) error {
+	log.Println("running ClickBannerAction")
+
+	if _, err := s.repo.GetBannerByID(ctx, bannerID); err != nil {
+		return err
+	}
+	tags, err := s.repo.GetTagsByBannerID(ctx, bannerID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(tags, tagID) {
+		return fmt.Errorf("banner %d is not shown for tag %d: %w", bannerID, tagID, pgx.ErrNoRows)
+	}
+	variants, err := s.repo.GetBannerVariants(ctx, bannerID)
+	if err != nil {
+		return err
+	}
+	if !hasVariant(variants, variantID) {
+		return fmt.Errorf("%w: banner %d has no variant %d", ErrInvalidVariant, bannerID, variantID)
+	}
+
+	s.stats.Record(model.BannerEvent{
+		Type:      model.EventClick,
+		BannerID:  bannerID,
+		TagID:     tagID,
+		VariantID: variantID,
+		Time:      time.Now(),
+	})
+	return nil
+}
+
+func hasVariant(variants []model.BannerVariant, variantID int) bool {
+	if len(variants) == 0 {
+		return variantID == 0
+	}
+	return slices.ContainsFunc(variants, func(v model.BannerVariant) bool { return v.ID == variantID })
+}
+
+func (s *Service) GetBannerStatsAction(ctx context.Context, id int) ([]model.BannerStats, error) {
+	log.Println("running GetBannerStatsAction")
+	if _, err := s.repo.GetBannerByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetBannerStats(ctx, id)
+}
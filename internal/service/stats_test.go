@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"banner-service/internal/adapter/memory"
+	"banner-service/internal/config"
+	"banner-service/internal/model"
+)
+
+func TestStatsWriterAggregatesEvents(t *testing.T) {
+	repo := newFakeStorage()
+	w := NewStatsWriter(repo, 100, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx, time.Hour)
+
+	day := time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		w.Record(model.BannerEvent{Type: model.EventImpression, BannerID: 1, TagID: 2, VariantID: 3, Time: day})
+	}
+	w.Record(model.BannerEvent{Type: model.EventClick, BannerID: 1, TagID: 2, VariantID: 3, Time: day.Add(time.Hour)})
+	w.Record(model.BannerEvent{Type: model.EventImpression, BannerID: 1, TagID: 2, VariantID: 3, Time: day.Add(24 * time.Hour)})
+
+	// оставшиеся события дописываются при остановке
+	cancel()
+	<-w.Done()
+
+	stats, err := repo.GetBannerStats(context.Background(), 1)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.BannerStats{
+		{BannerID: 1, Day: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), TagID: 2, VariantID: 3, Impressions: 3, Clicks: 1},
+		{BannerID: 1, Day: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), TagID: 2, VariantID: 3, Impressions: 1},
+	}, stats)
+}
+
+func TestStatsWriterFlushesFullBatch(t *testing.T) {
+	repo := newFakeStorage()
+	w := NewStatsWriter(repo, 100, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-w.Done()
+	}()
+	go w.Run(ctx, time.Hour)
+
+	now := time.Now()
+	w.Record(model.BannerEvent{Type: model.EventImpression, BannerID: 1, TagID: 1, Time: now})
+	w.Record(model.BannerEvent{Type: model.EventImpression, BannerID: 1, TagID: 2, Time: now})
+
+	assert.Eventually(t, func() bool {
+		stats, _ := repo.GetBannerStats(context.Background(), 1)
+		return len(stats) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStatsWriterCountsDroppedEvents(t *testing.T) {
+	repo := newFakeStorage()
+	w := NewStatsWriter(repo, 1, 100)
+
+	for i := 0; i < 3; i++ {
+		w.Record(model.BannerEvent{Type: model.EventImpression, BannerID: 1, TagID: 1, Time: time.Now()})
+	}
+	assert.Equal(t, int64(2), w.dropped.Load())
+
+	// счетчик сбрасывается, когда Run сообщает о потерях
+	w.flush(context.Background(), nil)
+	assert.Zero(t, w.dropped.Load())
+}
+
+func TestUserBannerRecordsImpression(t *testing.T) {
+	repo := newFakeStorage()
+	w := NewStatsWriter(repo, 100, 100)
+	cache := memory.NewCache(config.CacheConfig{TTL: time.Hour, CleanupInterval: time.Hour})
+	defer cache.Close()
+	s := NewService(repo, cache, w, NewRenderer(nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx, time.Hour)
+
+	id, err := s.CreateBannerAction(context.Background(), model.BannerParams{
+		TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "content", IsActive: ptr(true),
+	})
+	require.NoError(t, err)
+	_, err = s.GetUserBannerAction(context.Background(), model.GetUserBannerParams{TagID: 1, FeatureID: 10})
+	require.NoError(t, err)
+	require.NoError(t, s.ClickBannerAction(context.Background(), id, 1, 0))
+
+	cancel()
+	<-w.Done()
+
+	stats, err := s.GetBannerStatsAction(context.Background(), id)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, 1, stats[0].Impressions)
+	assert.Equal(t, 1, stats[0].Clicks)
+}
+
+func TestClickRejectsUnknownBannerTagAndVariant(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	plain, err := s.CreateBannerAction(ctx, model.BannerParams{TagIDs: ptr([]int{1}), FeatureID: ptr(10), Content: "plain"})
+	require.NoError(t, err)
+	withVariants, err := s.CreateBannerAction(ctx, model.BannerParams{
+		TagIDs:    ptr([]int{1}),
+		FeatureID: ptr(20),
+		Content:   "default",
+		Variants:  ptr([]model.BannerVariantParams{{Content: "a", Weight: 1}}),
+	})
+	require.NoError(t, err)
+	variants, err := s.repo.GetBannerVariants(ctx, withVariants)
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+
+	assert.ErrorIs(t, s.ClickBannerAction(ctx, 1000, 1, 0), pgx.ErrNoRows)
+	assert.ErrorIs(t, s.ClickBannerAction(ctx, plain, 2, 0), pgx.ErrNoRows, "tag is not linked to banner")
+	assert.ErrorIs(t, s.ClickBannerAction(ctx, plain, 1, variants[0].ID), ErrInvalidVariant)
+	assert.ErrorIs(t, s.ClickBannerAction(ctx, withVariants, 1, 0), ErrInvalidVariant)
+	assert.ErrorIs(t, s.ClickBannerAction(ctx, withVariants, 1, variants[0].ID+1), ErrInvalidVariant)
+
+	assert.NoError(t, s.ClickBannerAction(ctx, plain, 1, 0))
+	assert.NoError(t, s.ClickBannerAction(ctx, withVariants, 1, variants[0].ID))
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"banner-service/internal/model"
+)
+
+// maxQueryValueLen ограничивает длину значения из запроса, подставляемого в содержимое
+const maxQueryValueLen = 256
+
+// placeholderRe находит подстановки вида {{ user.tag_id }}. Шаблоны не поддерживают ни условий,
+// ни функций: подставить можно только значение переменной из белого списка
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.]+)\s*\}\}`)
+
+// Renderer подставляет переменные запроса в строковые поля содержимого баннера.
+// Доступны user.tag_id, feature.id, now.date и query.<name> для разрешенных параметров запроса
+type Renderer struct {
+	queryParams []string
+}
+
+func NewRenderer(queryParams []string) *Renderer {
+	return &Renderer{queryParams: queryParams}
+}
+
+// Render возвращает копию content с подставленными переменными. Исходное значение не меняется,
+// поэтому его можно держать в кэше. Неизвестные подстановки остаются как есть
+func (r *Renderer) Render(content interface{}, p model.GetUserBannerParams, now time.Time) interface{} {
+	return renderValue(content, r.vars(p, now))
+}
+
+func (r *Renderer) vars(p model.GetUserBannerParams, now time.Time) map[string]string {
+	vars := map[string]string{
+		"user.tag_id": strconv.Itoa(p.TagID),
+		"feature.id":  strconv.Itoa(p.FeatureID),
+		"now.date":    now.UTC().Format(time.DateOnly),
+	}
+	for _, name := range r.queryParams {
+		vars["query."+name] = truncate(p.Query.Get(name), maxQueryValueLen)
+	}
+	return vars
+}
+
+func renderValue(v interface{}, vars map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return placeholderRe.ReplaceAllStringFunc(v, func(placeholder string) string {
+			name := placeholderRe.FindStringSubmatch(placeholder)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			return placeholder
+		})
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			rendered[key] = renderValue(value, vars)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, value := range v {
+			rendered[i] = renderValue(value, vars)
+		}
+		return rendered
+	default:
+		return v
+	}
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
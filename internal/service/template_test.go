@@ -0,0 +1,53 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"banner-service/internal/model"
+)
+
+func TestRendererRender(t *testing.T) {
+	r := NewRenderer([]string{"utm_source"})
+	now := time.Date(2024, 4, 1, 23, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	p := model.GetUserBannerParams{
+		TagID:     7,
+		FeatureID: 3,
+		Query:     url.Values{"utm_source": {"push"}, "secret": {"token"}},
+	}
+
+	content := map[string]interface{}{
+		"title": "Hi, tag {{user.tag_id}}!",
+		"text":  "{{ now.date }} via {{query.utm_source}}",
+		"links": []interface{}{"/f/{{feature.id}}", 42.0, true, nil},
+		"nested": map[string]interface{}{
+			"unknown": "{{query.secret}} {{user.password}} {{ foo",
+		},
+	}
+
+	rendered := r.Render(content, p, now)
+
+	assert.Equal(t, map[string]interface{}{
+		"title": "Hi, tag 7!",
+		"text":  "2024-04-01 via push",
+		"links": []interface{}{"/f/3", 42.0, true, nil},
+		"nested": map[string]interface{}{
+			"unknown": "{{query.secret}} {{user.password}} {{ foo",
+		},
+	}, rendered)
+
+	// исходное содержимое лежит в кэше и не должно меняться
+	assert.Equal(t, "Hi, tag {{user.tag_id}}!", content["title"])
+	assert.Equal(t, "/f/{{feature.id}}", content["links"].([]interface{})[0])
+}
+
+func TestRendererMissingQueryParam(t *testing.T) {
+	r := NewRenderer([]string{"utm_source"})
+
+	rendered := r.Render("from {{query.utm_source}}", model.GetUserBannerParams{}, time.Now())
+
+	assert.Equal(t, "from ", rendered)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+
+	"banner-service/internal/model"
+)
+
+// pickVariant выбирает вариант баннера для пользователя. Выбор зависит только от баннера и userID,
+// поэтому пользователь видит один и тот же вариант, пока не изменится набор вариантов
+func pickVariant(b model.Banner, userID string) model.UserBanner {
+	total := 0
+	for _, v := range b.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return model.UserBanner{Content: b.Content}
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.Itoa(b.ID) + ":" + userID))
+	point := int(h.Sum64() % uint64(total))
+	for _, v := range b.Variants {
+		if point < v.Weight {
+			return model.UserBanner{Content: v.Content, VariantID: v.ID}
+		}
+		point -= v.Weight
+	}
+	// недостижимо: point всегда меньше суммы весов
+	return model.UserBanner{Content: b.Content}
+}
+
+// replaceBannerVariants приводит варианты баннера к переданному списку и возвращает сохраненные варианты.
+// Варианты с известным идентификатором обновляются на месте, чтобы X-Banner-Variant и статистика по ним
+// не менялись. Вариант с идентификатором, которого у баннера уже нет, создается с тем же идентификатором:
+// так откат к версии возвращает прежние варианты. Должен вызываться внутри транзакции
+func (s *Service) replaceBannerVariants(
+	ctx context.Context, bannerID int, variants []model.BannerVariantParams,
+) ([]model.BannerVariant, error) {
+	existing, err := s.repo.GetBannerVariants(ctx, bannerID)
+	if err != nil {
+		return nil, err
+	}
+	requested := make(map[int]struct{}, len(variants))
+	for _, v := range variants {
+		if v.ID != 0 {
+			requested[v.ID] = struct{}{}
+		}
+	}
+	stored := make(map[int]struct{}, len(existing))
+	for _, v := range existing {
+		if _, ok := requested[v.ID]; !ok {
+			if err := s.repo.DeleteBannerVariant(ctx, bannerID, v.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		stored[v.ID] = struct{}{}
+	}
+
+	saved := make([]model.BannerVariant, 0, len(variants))
+	for _, v := range variants {
+		variant := model.BannerVariant{ID: v.ID, Content: v.Content, Weight: v.Weight}
+		if _, ok := stored[v.ID]; ok {
+			err = s.repo.UpdateBannerVariant(ctx, bannerID, variant)
+		} else {
+			variant.ID, err = s.repo.CreateBannerVariant(ctx, bannerID, variant)
+		}
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, variant)
+	}
+	return saved, nil
+}
+
+// checkVariantIDs проверяет, что переданные variant_id - это текущие варианты баннера.
+// Идентификаторы новых вариантов выдает база, задать их в запросе нельзя
+func checkVariantIDs(existing []model.BannerVariant, variants *[]model.BannerVariantParams) error {
+	if variants == nil {
+		return nil
+	}
+	for i, v := range *variants {
+		if v.ID != 0 && !slices.ContainsFunc(existing, func(e model.BannerVariant) bool { return e.ID == v.ID }) {
+			return fmt.Errorf("%w: variants/%d/variant_id %d is not a variant of this banner", ErrInvalidVariant, i, v.ID)
+		}
+	}
+	return nil
+}
+
+// variantParams превращает сохраненные варианты обратно в параметры для отката к версии.
+// Идентификаторы сохраняются, чтобы восстановленные варианты остались теми же вариантами
+func variantParams(variants []model.BannerVariant) []model.BannerVariantParams {
+	params := make([]model.BannerVariantParams, 0, len(variants))
+	for _, v := range variants {
+		params = append(params, model.BannerVariantParams{ID: v.ID, Content: v.Content, Weight: v.Weight})
+	}
+	return params
+}
+
+// validateVariants проверяет содержимое каждого варианта по схеме фичи
+func (s *Service) validateVariants(ctx context.Context, featureID int, contents []interface{}) error {
+	for i, content := range contents {
+		err := s.validateContent(ctx, featureID, content)
+		var invalid *ErrInvalidContent
+		if errors.As(err, &invalid) {
+			invalid.Field = fmt.Sprintf("variants/%d/content", i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePatchedVariants проверяет новые варианты, а при смене фичи - и уже сохраненные
+func (s *Service) validatePatchedVariants(
+	ctx context.Context, banner model.Banner, variants *[]model.BannerVariantParams, featureChanged bool,
+) error {
+	if variants != nil {
+		return s.validateVariants(ctx, banner.FeatureID, variantContents(variants))
+	}
+	if !featureChanged {
+		return nil
+	}
+
+	stored, err := s.repo.GetBannerVariants(ctx, banner.ID)
+	if err != nil {
+		return err
+	}
+	contents := make([]interface{}, 0, len(stored))
+	for _, v := range stored {
+		contents = append(contents, v.Content)
+	}
+	return s.validateVariants(ctx, banner.FeatureID, contents)
+}
+
+func variantContents(variants *[]model.BannerVariantParams) []interface{} {
+	if variants == nil {
+		return nil
+	}
+	contents := make([]interface{}, 0, len(*variants))
+	for _, v := range *variants {
+		contents = append(contents, v.Content)
+	}
+	return contents
+}
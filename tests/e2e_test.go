@@ -14,11 +14,17 @@ import (
 	"testing"
 )
 
+var (
+	tagID     = rand.Int()
+	featureID = rand.Int()
+	isActive  = true
+)
+
 var params = model.BannerParams{
-	TagIDs:    []int{rand.Int()},
-	FeatureID: rand.Int(),
+	TagIDs:    &[]int{tagID},
+	FeatureID: &featureID,
 	Content:   `{"title":"test"}`,
-	IsActive:  true,
+	IsActive:  &isActive,
 }
 
 func getAdminToken() (string, error) {
@@ -120,8 +126,8 @@ func TestGetBanners(t *testing.T) {
 		t.Errorf("Error creating request: %v", err)
 	}
 	q := req.URL.Query()
-	q.Add("tag_id", fmt.Sprint(params.TagIDs[0]))
-	q.Add("feature_id", fmt.Sprint(params.FeatureID))
+	q.Add("tag_id", fmt.Sprint(tagID))
+	q.Add("feature_id", fmt.Sprint(featureID))
 	req.URL.RawQuery = q.Encode()
 
 	req.Header.Add("token", token)